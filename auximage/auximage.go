@@ -0,0 +1,120 @@
+package auximage
+
+import (
+	"io"
+	"strings"
+
+	"github.com/ysh86/lspic/jpeg"
+	"github.com/ysh86/lspic/xmp"
+)
+
+// Apple auxiliary image types (apdi:AuxiliaryImageType)
+const (
+	TypePortraitEffectsMatte = "urn:com.apple.photo:2018:aux:portraiteffectsmatte"
+	TypeSkinMatte            = "urn:com.apple.photo:2019:aux:semanticskinmatte"
+	TypeHairMatte            = "urn:com.apple.photo:2019:aux:semantichairmatte"
+	TypeTeethMatte           = "urn:com.apple.photo:2019:aux:semanticteethmatte"
+	TypeGlassesMatte         = "urn:com.apple.photo:2020:aux:semanticglassesmatte"
+	TypeSkyMatte             = "urn:com.apple.photo:2020:aux:semanticskymatte"
+	TypeHDRGainMap           = "urn:com.apple.photo:2020:aux:hdrgainmap"
+	TypeDepth                = "urn:com.apple.photo:2018:aux:depth"
+	TypeDisparity            = "urn:com.apple.photo:2018:aux:disparity"
+)
+
+var typeLabel = map[string]string{
+	TypePortraitEffectsMatte: "portrait matte",
+	TypeSkinMatte:            "skin matte",
+	TypeHairMatte:            "hair matte",
+	TypeTeethMatte:           "teeth matte",
+	TypeGlassesMatte:         "glasses matte",
+	TypeSkyMatte:             "sky matte",
+	TypeHDRGainMap:           "HDR gain map",
+	TypeDepth:                "depth",
+	TypeDisparity:            "disparity",
+}
+
+// Label returns the label of the auxiliary image type. The unknown types
+// are labeled by the last component of the URN.
+func Label(auxType string) string {
+	if label, ok := typeLabel[auxType]; ok {
+		return label
+	}
+	if i := strings.LastIndex(auxType, ":"); i >= 0 {
+		return auxType[i+1:]
+	}
+	return auxType
+}
+
+// AuxImage is an auxiliary image of the MPF.
+type AuxImage struct {
+	// apdi:AuxiliaryImageType
+	Type  string
+	Label string
+
+	// index in the MP Entry
+	Index int
+
+	// position of the JPEG in the file
+	Offset int64
+	Length int64
+
+	Image *io.SectionReader
+
+	// XMP of the auxiliary image
+	Properties *xmp.Packet
+}
+
+// Find finds the auxiliary images in the MPF secondary images tagged with
+// apdi:AuxiliaryImageType. It returns nil if the file has none.
+func Find(f *jpeg.File) ([]*AuxImage, error) {
+	if f.MPF() == nil {
+		return nil, nil
+	}
+	images, err := f.MPImages()
+	if err != nil {
+		return nil, err
+	}
+
+	var auxImages []*AuxImage
+	for i, img := range images {
+		if img.FileOffset == 0 || !img.IsJPEG() {
+			continue
+		}
+
+		sr := f.Section(img.FileOffset, img.Size)
+		sub, err := jpeg.NewFile(sr)
+		if err != nil {
+			return nil, err
+		}
+		if err := sub.Parse(); err != nil {
+			return nil, err
+		}
+		x, err := sub.XMP()
+		if err != nil {
+			return nil, err
+		}
+		if x == nil {
+			continue
+		}
+		p, err := xmp.Parse(x.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		auxType := p.Property(xmp.NsAPDI, "AuxiliaryImageType")
+		if auxType == nil {
+			continue
+		}
+
+		auxImages = append(auxImages, &AuxImage{
+			Type:       auxType.Value,
+			Label:      Label(auxType.Value),
+			Index:      i,
+			Offset:     img.FileOffset,
+			Length:     img.Size,
+			Image:      sr,
+			Properties: p,
+		})
+	}
+
+	return auxImages, nil
+}
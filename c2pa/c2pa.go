@@ -0,0 +1,437 @@
+package c2pa
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ysh86/lspic/cbor"
+	"github.com/ysh86/lspic/jpeg"
+	"github.com/ysh86/lspic/jumbf"
+)
+
+// c2paUUID returns the UUID of the C2PA box: the 4 characters followed by
+// 0011-0010-8000-00AA00389B71.
+func c2paUUID(tag string) jumbf.UUID {
+	u := jumbf.UUID{0, 0, 0, 0, 0x00, 0x11, 0x00, 0x10, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71}
+	copy(u[:4], tag)
+	return u
+}
+
+// types of the superboxes
+var (
+	UUIDStore           = c2paUUID("c2pa")
+	UUIDManifest        = c2paUUID("c2ma")
+	UUIDUpdateManifest  = c2paUUID("c2um")
+	UUIDAssertionStore  = c2paUUID("c2as")
+	UUIDClaim           = c2paUUID("c2cl")
+	UUIDClaimSignature  = c2paUUID("c2cs")
+	UUIDCredentialStore = c2paUUID("c2vc")
+)
+
+// labels of the boxes
+const (
+	LabelStore          = "c2pa"
+	LabelAssertions     = "c2pa.assertions"
+	LabelClaim          = "c2pa.claim"
+	LabelClaimV2        = "c2pa.claim.v2"
+	LabelSignature      = "c2pa.signature"
+	LabelDataHash       = "c2pa.hash.data"
+	LabelActions        = "c2pa.actions"
+	LabelActionsV2      = "c2pa.actions.v2"
+	LabelIngredient     = "c2pa.ingredient"
+	LabelIngredientV3   = "c2pa.ingredient.v3"
+	LabelThumbnailClaim = "c2pa.thumbnail.claim"
+)
+
+// COSE algorithm
+const (
+	AlgES256 int64 = -7
+	AlgES384 int64 = -35
+	AlgES512 int64 = -36
+	AlgPS256 int64 = -37
+	AlgPS384 int64 = -38
+	AlgPS512 int64 = -39
+	AlgEdDSA int64 = -8
+)
+
+var algName = map[int64]string{
+	AlgES256: "ES256",
+	AlgES384: "ES384",
+	AlgES512: "ES512",
+	AlgPS256: "PS256",
+	AlgPS384: "PS384",
+	AlgPS512: "PS512",
+	AlgEdDSA: "EdDSA",
+}
+
+// COSE header
+const (
+	headerAlg     = 1
+	headerX5Chain = 33
+)
+
+// HashedURI is a reference to a box with its hash.
+type HashedURI struct {
+	URL  string
+	Alg  string // "" for the algorithm of the claim
+	Hash []byte
+}
+
+// Claim is the claim of the manifest.
+type Claim struct {
+	Label string // c2pa.claim or c2pa.claim.v2
+	// Raw is the CBOR of the claim signed by the signature.
+	Raw    []byte
+	Fields map[interface{}]interface{}
+
+	Generator  string
+	Title      string
+	Format     string
+	InstanceID string
+	Alg        string
+
+	Assertions   []*HashedURI
+	SignatureURL string
+}
+
+// Assertion is an assertion of the assertion store.
+type Assertion struct {
+	Label string
+	Box   *jumbf.Box
+	// Content is the decoded CBOR or JSON, or nil for the other types
+	// (e.g. the thumbnails).
+	Content interface{}
+}
+
+// Signature is the claim signature (COSE_Sign1).
+type Signature struct {
+	Alg          int64
+	Certificates []*x509.Certificate // the signer first
+	Value        []byte
+
+	protected []byte
+}
+
+// AlgName returns the name of the algorithm of the signature.
+func (s *Signature) AlgName() string {
+	if name, ok := algName[s.Alg]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d", s.Alg)
+}
+
+// Manifest is a C2PA manifest.
+type Manifest struct {
+	Label string // e.g. urn:uuid:...
+	Box   *jumbf.Box
+	// Hash is SHA-256 of the manifest box excluding its header.
+	Hash []byte
+
+	Claim      *Claim
+	Assertions []*Assertion
+	Signature  *Signature
+}
+
+// Store is the manifest store of the file.
+type Store struct {
+	Box       *jumbf.Box
+	Manifests []*Manifest
+}
+
+// Active returns the active manifest, i.e. the last one of the store.
+func (s *Store) Active() *Manifest {
+	if len(s.Manifests) == 0 {
+		return nil
+	}
+	return s.Manifests[len(s.Manifests)-1]
+}
+
+// Find finds the C2PA manifest store in the JUMBF boxes of the file.
+// It returns nil if the file has no manifest store.
+func Find(f *jpeg.File) (*Store, error) {
+	raws, err := f.JUMBF()
+	if err != nil {
+		return nil, err
+	}
+	for _, raw := range raws {
+		boxes, err := jumbf.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		for _, box := range boxes {
+			if box.Description != nil && box.Description.Type == UUIDStore {
+				return Parse(box)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Parse parses the manifest store box.
+func Parse(box *jumbf.Box) (*Store, error) {
+	s := &Store{Box: box}
+	for _, b := range box.Boxes {
+		if b.Description == nil || (b.Description.Type != UUIDManifest && b.Description.Type != UUIDUpdateManifest) {
+			continue
+		}
+		m, err := parseManifest(b)
+		if err != nil {
+			return nil, fmt.Errorf("manifest %s: %w", b.Label(), err)
+		}
+		s.Manifests = append(s.Manifests, m)
+	}
+	return s, nil
+}
+
+func parseManifest(box *jumbf.Box) (*Manifest, error) {
+	sum := sha256.Sum256(box.Payload)
+	m := &Manifest{Label: box.Label(), Box: box, Hash: sum[:]}
+
+	for _, b := range box.Boxes {
+		if b.Description == nil {
+			continue
+		}
+		switch b.Description.Type {
+		case UUIDAssertionStore:
+			for _, a := range b.Boxes {
+				if a.Description == nil {
+					continue
+				}
+				assertion, err := parseAssertion(a)
+				if err != nil {
+					return nil, fmt.Errorf("assertion %s: %w", a.Label(), err)
+				}
+				m.Assertions = append(m.Assertions, assertion)
+			}
+		case UUIDClaim:
+			claim, err := parseClaim(b)
+			if err != nil {
+				return nil, fmt.Errorf("claim: %w", err)
+			}
+			m.Claim = claim
+		case UUIDClaimSignature:
+			sig, err := parseSignature(b)
+			if err != nil {
+				return nil, fmt.Errorf("signature: %w", err)
+			}
+			m.Signature = sig
+		}
+	}
+	return m, nil
+}
+
+func parseAssertion(box *jumbf.Box) (*Assertion, error) {
+	a := &Assertion{Label: box.Label(), Box: box}
+	if c := box.Content(jumbf.TypeCBOR); c != nil {
+		v, err := cbor.Decode(c.Payload)
+		if err != nil {
+			return nil, err
+		}
+		a.Content = v
+	} else if c := box.Content(jumbf.TypeJSON); c != nil {
+		if err := json.Unmarshal(c.Payload, &a.Content); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+func parseClaim(box *jumbf.Box) (*Claim, error) {
+	c := &Claim{Label: box.Label()}
+	content := box.Content(jumbf.TypeCBOR)
+	if content == nil {
+		return nil, errors.New("no CBOR")
+	}
+	c.Raw = content.Payload
+	v, err := cbor.Decode(c.Raw)
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("claim is not a map")
+	}
+	c.Fields = fields
+
+	c.Generator = text(fields["claim_generator"])
+	info := fields["claim_generator_info"]
+	if list, ok := info.([]interface{}); ok && len(list) > 0 {
+		// v1
+		info = list[0]
+	}
+	if info, ok := info.(map[interface{}]interface{}); ok && c.Generator == "" {
+		c.Generator = strings.TrimSpace(text(info["name"]) + " " + text(info["version"]))
+	}
+	c.Title = text(fields["dc:title"])
+	c.Format = text(fields["dc:format"])
+	c.InstanceID = text(fields["instanceID"])
+	c.Alg = text(fields["alg"])
+	if c.Alg == "" {
+		c.Alg = "sha256"
+	}
+	c.SignatureURL = text(fields["signature"])
+
+	// assertions of v1, created_assertions and gathered_assertions of v2
+	for _, key := range []string{"assertions", "created_assertions", "gathered_assertions"} {
+		refs, _ := fields[key].([]interface{})
+		for _, ref := range refs {
+			uri, err := hashedURI(ref)
+			if err != nil {
+				return nil, err
+			}
+			c.Assertions = append(c.Assertions, uri)
+		}
+	}
+	return c, nil
+}
+
+func hashedURI(v interface{}) (*HashedURI, error) {
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("invalid hashed URI")
+	}
+	uri := &HashedURI{URL: text(m["url"]), Alg: text(m["alg"])}
+	uri.Hash, _ = m["hash"].([]byte)
+	if uri.URL == "" || uri.Hash == nil {
+		return nil, errors.New("invalid hashed URI")
+	}
+	return uri, nil
+}
+
+func parseSignature(box *jumbf.Box) (*Signature, error) {
+	content := box.Content(jumbf.TypeCBOR)
+	if content == nil {
+		return nil, errors.New("no CBOR")
+	}
+	v, err := cbor.Decode(content.Payload)
+	if err != nil {
+		return nil, err
+	}
+	// COSE_Sign1_Tagged or COSE_Sign1
+	if tag, ok := v.(cbor.Tag); ok && tag.Number == 18 {
+		v = tag.Content
+	}
+	a, ok := v.([]interface{})
+	if !ok || len(a) != 4 {
+		return nil, errors.New("invalid COSE_Sign1")
+	}
+	protected, ok1 := a[0].([]byte)
+	unprotected, ok2 := a[1].(map[interface{}]interface{})
+	value, ok3 := a[3].([]byte)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, errors.New("invalid COSE_Sign1")
+	}
+
+	s := &Signature{Value: value, protected: protected}
+	headers := map[interface{}]interface{}{}
+	if len(protected) > 0 {
+		v, err := cbor.Decode(protected)
+		if err != nil {
+			return nil, err
+		}
+		if headers, ok = v.(map[interface{}]interface{}); !ok {
+			return nil, errors.New("invalid protected header")
+		}
+	}
+	alg, ok := headers[int64(headerAlg)].(int64)
+	if !ok {
+		return nil, errors.New("no algorithm")
+	}
+	s.Alg = alg
+
+	// x5chain is in the protected header, or the unprotected one of the
+	// older manifests
+	chain, ok := headers[int64(headerX5Chain)]
+	if !ok {
+		chain = unprotected[int64(headerX5Chain)]
+	}
+	var ders []interface{}
+	switch chain := chain.(type) {
+	case []byte:
+		ders = []interface{}{chain}
+	case []interface{}:
+		ders = chain
+	}
+	for _, der := range ders {
+		b, ok := der.([]byte)
+		if !ok {
+			return nil, errors.New("invalid x5chain")
+		}
+		cert, err := x509.ParseCertificate(b)
+		if err != nil {
+			return nil, err
+		}
+		s.Certificates = append(s.Certificates, cert)
+	}
+	return s, nil
+}
+
+func text(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// resolve returns the box referred by the JUMBF URI in the manifest.
+func (s *Store) resolve(m *Manifest, url string) *jumbf.Box {
+	path, ok := strings.CutPrefix(url, "self#jumbf=")
+	if !ok {
+		return nil
+	}
+	if abs, ok := strings.CutPrefix(path, "/"); ok {
+		label, rest, _ := strings.Cut(abs, "/")
+		if label != s.Box.Label() {
+			return nil
+		}
+		return s.Box.Find(rest)
+	}
+	return m.Box.Find(path)
+}
+
+// String makes Store satisfy the Stringer interface.
+func (s *Store) String() string {
+	var buf bytes.Buffer
+	for i, m := range s.Manifests {
+		active := ""
+		if i == len(s.Manifests)-1 {
+			active = " (active)"
+		}
+		buf.WriteString(fmt.Sprintf("  manifest %s%s: sha256=%s\n", m.Label, active, hex.EncodeToString(m.Hash)))
+		if c := m.Claim; c != nil {
+			buf.WriteString(fmt.Sprintf("    claim: %s, generator=\"%s\", title=\"%s\", format=%s, instanceID=%s\n", c.Label, c.Generator, c.Title, c.Format, c.InstanceID))
+		}
+		for _, a := range m.Assertions {
+			buf.WriteString(fmt.Sprintf("    assertion: %s\n", a.Label))
+			if a.Label == LabelActions || a.Label == LabelActionsV2 {
+				for _, action := range actions(a.Content) {
+					buf.WriteString(fmt.Sprintf("      action: %s\n", action))
+				}
+			}
+		}
+		if sig := m.Signature; sig != nil {
+			buf.WriteString(fmt.Sprintf("    signature: %s, %d[bytes]\n", sig.AlgName(), len(sig.Value)))
+			for _, cert := range sig.Certificates {
+				buf.WriteString(fmt.Sprintf("      certificate: %s (issuer: %s)\n", cert.Subject, cert.Issuer))
+			}
+		}
+	}
+	return buf.String()
+}
+
+// actions returns the names of the actions of c2pa.actions.
+func actions(content interface{}) []string {
+	m, _ := content.(map[interface{}]interface{})
+	list, _ := m["actions"].([]interface{})
+	var names []string
+	for _, a := range list {
+		if a, ok := a.(map[interface{}]interface{}); ok {
+			names = append(names, text(a["action"]))
+		}
+	}
+	return names
+}
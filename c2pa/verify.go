@@ -0,0 +1,279 @@
+package c2pa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"sort"
+
+	"github.com/ysh86/lspic/cbor"
+)
+
+// status codes of the validation
+const (
+	StatusClaimSignatureValidated    = "claimSignature.validated"
+	StatusClaimSignatureMismatch     = "claimSignature.mismatch"
+	StatusClaimSignatureMissing      = "claimSignature.missing"
+	StatusClaimMissing               = "claim.missing"
+	StatusSigningCredentialTrusted   = "signingCredential.trusted"
+	StatusSigningCredentialInvalid   = "signingCredential.invalid"
+	StatusSigningCredentialUntrusted = "signingCredential.untrusted"
+	StatusHashedURIMatch             = "assertion.hashedURI.match"
+	StatusHashedURIMismatch          = "assertion.hashedURI.mismatch"
+	StatusAssertionMissing           = "assertion.missing"
+	StatusDataHashMatch              = "assertion.dataHash.match"
+	StatusDataHashMismatch           = "assertion.dataHash.mismatch"
+	StatusDataHashMalformed          = "assertion.dataHash.malformed"
+	StatusAlgorithmUnsupported       = "algorithm.unsupported"
+)
+
+// Result is a result of the validation of a manifest.
+type Result struct {
+	Manifest string
+	Code     string
+	Success  bool
+	URL      string // the assertion, if any
+	Detail   string
+}
+
+// String makes Result satisfy the Stringer interface.
+func (r *Result) String() string {
+	s := r.Code
+	if r.URL != "" {
+		s += " " + r.URL
+	}
+	if r.Detail != "" {
+		s += ": " + r.Detail
+	}
+	return s
+}
+
+func newHash(alg string) (hash.Hash, error) {
+	switch alg {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha384":
+		return sha512.New384(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported hash: %s", alg)
+}
+
+// Verify validates the manifests of the store. The hashes of the
+// assertions and the signatures are checked for all the manifests, and the
+// data hash (c2pa.hash.data) of the active manifest is checked against the
+// file read by r. The chain of the signing certificates is verified by the
+// roots at the current time only if roots is not nil.
+func (s *Store) Verify(r *io.SectionReader, roots *x509.CertPool) []*Result {
+	var results []*Result
+	for i, m := range s.Manifests {
+		add := func(code string, success bool, url, detail string) {
+			results = append(results, &Result{Manifest: m.Label, Code: code, Success: success, URL: url, Detail: detail})
+		}
+
+		if m.Claim == nil {
+			add(StatusClaimMissing, false, "", "")
+			continue
+		}
+
+		// hashed URIs of the assertions
+		for _, uri := range m.Claim.Assertions {
+			box := s.resolve(m, uri.URL)
+			if box == nil {
+				add(StatusAssertionMissing, false, uri.URL, "")
+				continue
+			}
+			alg := uri.Alg
+			if alg == "" {
+				alg = m.Claim.Alg
+			}
+			h, err := newHash(alg)
+			if err != nil {
+				add(StatusAlgorithmUnsupported, false, uri.URL, alg)
+				continue
+			}
+			h.Write(box.Payload)
+			if bytes.Equal(h.Sum(nil), uri.Hash) {
+				add(StatusHashedURIMatch, true, uri.URL, "")
+			} else {
+				add(StatusHashedURIMismatch, false, uri.URL, "")
+			}
+		}
+
+		// data hash of the active manifest
+		if i == len(s.Manifests)-1 {
+			for _, a := range m.Assertions {
+				if a.Label != LabelDataHash {
+					continue
+				}
+				ok, err := verifyDataHash(r, a.Content, m.Claim.Alg)
+				if err != nil {
+					add(StatusDataHashMalformed, false, a.Label, err.Error())
+				} else if ok {
+					add(StatusDataHashMatch, true, a.Label, "")
+				} else {
+					add(StatusDataHashMismatch, false, a.Label, "")
+				}
+			}
+		}
+
+		// signature
+		if m.Signature == nil {
+			add(StatusClaimSignatureMissing, false, "", "")
+			continue
+		}
+		if err := m.Signature.verify(m.Claim.Raw); err != nil {
+			add(StatusClaimSignatureMismatch, false, "", err.Error())
+		} else {
+			add(StatusClaimSignatureValidated, true, "", "")
+		}
+		if roots != nil {
+			if err := m.Signature.verifyChain(roots); err != nil {
+				add(StatusSigningCredentialUntrusted, false, "", err.Error())
+			} else {
+				add(StatusSigningCredentialTrusted, true, "", "")
+			}
+		}
+	}
+	return results
+}
+
+// verifyDataHash verifies the hash of the file excluding the ranges of
+// the manifest store.
+func verifyDataHash(r *io.SectionReader, content interface{}, claimAlg string) (bool, error) {
+	m, ok := content.(map[interface{}]interface{})
+	if !ok {
+		return false, errors.New("data hash is not a map")
+	}
+	expected, ok := m["hash"].([]byte)
+	if !ok {
+		return false, errors.New("no hash")
+	}
+	alg := text(m["alg"])
+	if alg == "" {
+		alg = claimAlg
+	}
+	h, err := newHash(alg)
+	if err != nil {
+		return false, err
+	}
+
+	type exclusion struct {
+		start, length int64
+	}
+	var exclusions []exclusion
+	list, _ := m["exclusions"].([]interface{})
+	for _, e := range list {
+		e, _ := e.(map[interface{}]interface{})
+		start, ok1 := e["start"].(int64)
+		length, ok2 := e["length"].(int64)
+		if !ok1 || !ok2 || start < 0 || length < 0 || start > r.Size() || length > r.Size()-start {
+			return false, errors.New("invalid exclusion")
+		}
+		exclusions = append(exclusions, exclusion{start, length})
+	}
+	sort.Slice(exclusions, func(i, j int) bool {
+		return exclusions[i].start < exclusions[j].start
+	})
+
+	var offset int64
+	for _, e := range exclusions {
+		if e.start < offset {
+			return false, errors.New("overlapped exclusions")
+		}
+		if _, err := io.Copy(h, io.NewSectionReader(r, offset, e.start-offset)); err != nil {
+			return false, err
+		}
+		offset = e.start + e.length
+	}
+	if _, err := io.Copy(h, io.NewSectionReader(r, offset, r.Size()-offset)); err != nil {
+		return false, err
+	}
+	return bytes.Equal(h.Sum(nil), expected), nil
+}
+
+// verify verifies the signature of the claim (RFC 9052 Sig_structure of
+// the detached payload).
+func (s *Signature) verify(claim []byte) error {
+	if len(s.Certificates) == 0 {
+		return errors.New("no certificate")
+	}
+	toBeSigned, err := cbor.Encode([]interface{}{"Signature1", s.protected, []byte{}, claim})
+	if err != nil {
+		return err
+	}
+
+	var h crypto.Hash
+	switch s.Alg {
+	case AlgES256, AlgPS256:
+		h = crypto.SHA256
+	case AlgES384, AlgPS384:
+		h = crypto.SHA384
+	case AlgES512, AlgPS512:
+		h = crypto.SHA512
+	case AlgEdDSA:
+		pub, ok := s.Certificates[0].PublicKey.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(pub, toBeSigned, s.Value) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported algorithm: %d", s.Alg)
+	}
+	d := h.New()
+	d.Write(toBeSigned)
+	digest := d.Sum(nil)
+
+	switch pub := s.Certificates[0].PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		if s.Alg != AlgES256 && s.Alg != AlgES384 && s.Alg != AlgES512 {
+			return errors.New("key mismatch")
+		}
+		// r || s, or DER of the older signers
+		n := (pub.Curve.Params().BitSize + 7) / 8
+		if len(s.Value) == 2*n {
+			r := new(big.Int).SetBytes(s.Value[:n])
+			sv := new(big.Int).SetBytes(s.Value[n:])
+			if ecdsa.Verify(pub, digest, r, sv) {
+				return nil
+			}
+		} else if ecdsa.VerifyASN1(pub, digest, s.Value) {
+			return nil
+		}
+		return errors.New("invalid signature")
+	case *rsa.PublicKey:
+		if s.Alg != AlgPS256 && s.Alg != AlgPS384 && s.Alg != AlgPS512 {
+			return errors.New("key mismatch")
+		}
+		return rsa.VerifyPSS(pub, h, digest, s.Value, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	}
+	return errors.New("unsupported key")
+}
+
+// verifyChain verifies the chain of the certificates by the roots.
+func (s *Signature) verifyChain(roots *x509.CertPool) error {
+	if len(s.Certificates) == 0 {
+		return errors.New("no certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range s.Certificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := s.Certificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err
+}
@@ -0,0 +1,149 @@
+package c2pa
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestVerifyDataHash(t *testing.T) {
+	data := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	r := io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data)))
+
+	// hashes of the data excluding the ranges
+	sum256 := func(ranges ...[2]int) []byte {
+		h := sha256.New()
+		offset := 0
+		for _, e := range ranges {
+			h.Write(data[offset:e[0]])
+			offset = e[0] + e[1]
+		}
+		h.Write(data[offset:])
+		return h.Sum(nil)
+	}
+	sum384 := sha512.Sum384(data)
+	exclusions := func(ranges ...[2]int64) []interface{} {
+		var list []interface{}
+		for _, e := range ranges {
+			list = append(list, map[interface{}]interface{}{"start": e[0], "length": e[1]})
+		}
+		return list
+	}
+
+	tests := []struct {
+		name     string
+		content  interface{}
+		claimAlg string
+		want     bool
+		err      string
+	}{
+		{
+			name:    "no exclusion",
+			content: map[interface{}]interface{}{"hash": sum256(), "alg": "sha256"},
+			want:    true,
+		},
+		{
+			name:    "empty exclusion",
+			content: map[interface{}]interface{}{"hash": sum256(), "alg": "sha256", "exclusions": exclusions([2]int64{4, 0})},
+			want:    true,
+		},
+		{
+			name:    "exclusion in the middle",
+			content: map[interface{}]interface{}{"hash": sum256([2]int{10, 6}), "alg": "sha256", "exclusions": exclusions([2]int64{10, 6})},
+			want:    true,
+		},
+		{
+			name:    "exclusions at the both ends",
+			content: map[interface{}]interface{}{"hash": sum256([2]int{0, 2}, [2]int{30, 6}), "alg": "sha256", "exclusions": exclusions([2]int64{0, 2}, [2]int64{30, 6})},
+			want:    true,
+		},
+		{
+			name:    "unordered exclusions",
+			content: map[interface{}]interface{}{"hash": sum256([2]int{2, 3}, [2]int{5, 4}, [2]int{20, 1}), "alg": "sha256", "exclusions": exclusions([2]int64{20, 1}, [2]int64{2, 3}, [2]int64{5, 4})},
+			want:    true,
+		},
+		{
+			name:    "hash including the exclusion",
+			content: map[interface{}]interface{}{"hash": sum256(), "alg": "sha256", "exclusions": exclusions([2]int64{10, 6})},
+			want:    false,
+		},
+		{
+			name:    "wrong hash",
+			content: map[interface{}]interface{}{"hash": sum256([2]int{10, 5}), "alg": "sha256", "exclusions": exclusions([2]int64{10, 6})},
+			want:    false,
+		},
+		{
+			name:    "alg of the data hash",
+			content: map[interface{}]interface{}{"hash": sum384[:], "alg": "sha384"},
+			want:    true,
+		},
+		{
+			name:     "alg of the claim",
+			content:  map[interface{}]interface{}{"hash": sum384[:]},
+			claimAlg: "sha384",
+			want:     true,
+		},
+		{
+			name:    "overlapped exclusions",
+			content: map[interface{}]interface{}{"hash": sum256(), "alg": "sha256", "exclusions": exclusions([2]int64{10, 6}, [2]int64{15, 2})},
+			err:     "overlapped exclusions",
+		},
+		{
+			name:    "exclusion beyond the end",
+			content: map[interface{}]interface{}{"hash": sum256(), "alg": "sha256", "exclusions": exclusions([2]int64{30, 7})},
+			err:     "invalid exclusion",
+		},
+		{
+			name:    "exclusion after the end",
+			content: map[interface{}]interface{}{"hash": sum256(), "alg": "sha256", "exclusions": exclusions([2]int64{37, 0})},
+			err:     "invalid exclusion",
+		},
+		{
+			name:    "negative start",
+			content: map[interface{}]interface{}{"hash": sum256(), "alg": "sha256", "exclusions": exclusions([2]int64{-1, 2})},
+			err:     "invalid exclusion",
+		},
+		{
+			name:    "negative length",
+			content: map[interface{}]interface{}{"hash": sum256(), "alg": "sha256", "exclusions": exclusions([2]int64{10, -2})},
+			err:     "invalid exclusion",
+		},
+		{
+			name:    "invalid exclusion",
+			content: map[interface{}]interface{}{"hash": sum256(), "alg": "sha256", "exclusions": []interface{}{"0-1"}},
+			err:     "invalid exclusion",
+		},
+		{
+			name:    "unsupported alg",
+			content: map[interface{}]interface{}{"hash": sum256(), "alg": "md5"},
+			err:     "unsupported hash",
+		},
+		{
+			name:    "no hash",
+			content: map[interface{}]interface{}{"alg": "sha256"},
+			err:     "no hash",
+		},
+		{
+			name:    "not a map",
+			content: []interface{}{sum256()},
+			err:     "not a map",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifyDataHash(r, tt.content, tt.claimAlg)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("got error %v, want %q", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// major type
+const (
+	typeUint   = 0
+	typeNegInt = 1
+	typeBytes  = 2
+	typeText   = 3
+	typeArray  = 4
+	typeMap    = 5
+	typeTag    = 6
+	typeSimple = 7
+)
+
+// limit of the nesting of arrays, maps and tags
+const maxDepth = 64
+
+// Tag is a tagged data item.
+type Tag struct {
+	Number  uint64
+	Content interface{}
+}
+
+// Undefined is the simple value undefined.
+type Undefined struct{}
+
+// Decode decodes a CBOR (RFC 8949) data item into:
+//   - int64 (or uint64 if it overflows int64) for the integers
+//   - []byte, string, []interface{}, map[interface{}]interface{}
+//   - Tag, bool, nil, Undefined and float64
+func Decode(b []byte) (interface{}, error) {
+	d := &decoder{b: b}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.off != len(d.b) {
+		return nil, errors.New("extra data after CBOR")
+	}
+	return v, nil
+}
+
+type decoder struct {
+	b   []byte
+	off int
+}
+
+func (d *decoder) next(n uint64) ([]byte, error) {
+	if n > uint64(len(d.b)-d.off) {
+		return nil, errors.New("unexpected end of CBOR")
+	}
+	b := d.b[d.off : d.off+int(n)]
+	d.off += int(n)
+	return b, nil
+}
+
+// head returns the major type, the additional information and the
+// argument. The additional information 31 is the indefinite length.
+func (d *decoder) head() (major, info byte, arg uint64, err error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = b[0]>>5, b[0]&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		b, err := d.next(1 << (info - 24))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		for _, c := range b {
+			arg = arg<<8 | uint64(c)
+		}
+		return major, info, arg, nil
+	case info == 31 && major >= typeBytes && major != typeTag:
+		return major, info, 0, nil
+	}
+	return 0, 0, 0, fmt.Errorf("invalid additional information: %d", info)
+}
+
+// isBreak consumes the break code of the indefinite length.
+func (d *decoder) isBreak() bool {
+	if d.off < len(d.b) && d.b[d.off] == 0xff {
+		d.off++
+		return true
+	}
+	return false
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errors.New("too deep CBOR")
+	}
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	indefinite := info == 31
+
+	switch major {
+	case typeUint:
+		if arg > math.MaxInt64 {
+			return arg, nil
+		}
+		return int64(arg), nil
+	case typeNegInt:
+		if arg > math.MaxInt64 {
+			return nil, errors.New("too small negative integer")
+		}
+		return -1 - int64(arg), nil
+	case typeBytes, typeText:
+		var s []byte
+		if indefinite {
+			// concatenation of the definite chunks
+			s = []byte{}
+			for !d.isBreak() {
+				m, i, n, err := d.head()
+				if err != nil {
+					return nil, err
+				}
+				if m != major || i == 31 {
+					return nil, errors.New("invalid chunk of indefinite string")
+				}
+				chunk, err := d.next(n)
+				if err != nil {
+					return nil, err
+				}
+				s = append(s, chunk...)
+			}
+		} else if s, err = d.next(arg); err != nil {
+			return nil, err
+		}
+		if major == typeText {
+			return string(s), nil
+		}
+		return s, nil
+	case typeArray:
+		if !indefinite && arg > uint64(len(d.b)-d.off) {
+			return nil, errors.New("unexpected end of CBOR")
+		}
+		a := []interface{}{}
+		for i := uint64(0); indefinite || i < arg; i++ {
+			if indefinite && d.isBreak() {
+				break
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	case typeMap:
+		if !indefinite && arg > uint64(len(d.b)-d.off)/2 {
+			return nil, errors.New("unexpected end of CBOR")
+		}
+		m := make(map[interface{}]interface{})
+		for i := uint64(0); indefinite || i < arg; i++ {
+			if indefinite && d.isBreak() {
+				break
+			}
+			k, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, uint64, string, bool, nil:
+			default:
+				return nil, fmt.Errorf("unsupported key of map: %T", k)
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	case typeTag:
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Tag{Number: arg, Content: v}, nil
+	}
+
+	// typeSimple
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22:
+		return nil, nil
+	case 23:
+		return Undefined{}, nil
+	case 25:
+		return halfFloat(uint16(arg)), nil
+	case 26:
+		return float64(math.Float32frombits(uint32(arg))), nil
+	case 27:
+		return math.Float64frombits(arg), nil
+	case 31:
+		return nil, errors.New("unexpected break")
+	}
+	return nil, fmt.Errorf("unsupported simple value: %d", arg)
+}
+
+// halfFloat converts the IEEE 754 half-precision float.
+func halfFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -v
+	}
+	return v
+}
+
+// Encode encodes v into CBOR. The types of Decode, int and the maps of
+// the string keys are supported. The keys of the maps are sorted in the
+// bytewise order of their encodings (deterministic encoding).
+func Encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeHead(buf *bytes.Buffer, major byte, arg uint64) {
+	switch {
+	case arg < 24:
+		buf.WriteByte(major<<5 | byte(arg))
+	case arg <= math.MaxUint8:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(arg))
+	case arg <= math.MaxUint16:
+		buf.WriteByte(major<<5 | 25)
+		binary.Write(buf, binary.BigEndian, uint16(arg))
+	case arg <= math.MaxUint32:
+		buf.WriteByte(major<<5 | 26)
+		binary.Write(buf, binary.BigEndian, uint32(arg))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		binary.Write(buf, binary.BigEndian, arg)
+	}
+}
+
+func encode(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xf6)
+	case Undefined:
+		buf.WriteByte(0xf7)
+	case bool:
+		if v {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case int:
+		return encode(buf, int64(v))
+	case int64:
+		if v < 0 {
+			writeHead(buf, typeNegInt, uint64(-1-v))
+		} else {
+			writeHead(buf, typeUint, uint64(v))
+		}
+	case uint64:
+		writeHead(buf, typeUint, v)
+	case float64:
+		buf.WriteByte(typeSimple<<5 | 27)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case []byte:
+		writeHead(buf, typeBytes, uint64(len(v)))
+		buf.Write(v)
+	case string:
+		writeHead(buf, typeText, uint64(len(v)))
+		buf.WriteString(v)
+	case []interface{}:
+		writeHead(buf, typeArray, uint64(len(v)))
+		for _, e := range v {
+			if err := encode(buf, e); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		m := make(map[interface{}]interface{}, len(v))
+		for k, e := range v {
+			m[k] = e
+		}
+		return encode(buf, m)
+	case map[interface{}]interface{}:
+		type entry struct {
+			key, value []byte
+		}
+		entries := make([]entry, 0, len(v))
+		for k, e := range v {
+			key, err := Encode(k)
+			if err != nil {
+				return err
+			}
+			value, err := Encode(e)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry{key, value})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return bytes.Compare(entries[i].key, entries[j].key) < 0
+		})
+		writeHead(buf, typeMap, uint64(len(v)))
+		for _, e := range entries {
+			buf.Write(e.key)
+			buf.Write(e.value)
+		}
+	case Tag:
+		writeHead(buf, typeTag, v.Number)
+		return encode(buf, v.Content)
+	default:
+		return fmt.Errorf("unsupported type: %T", v)
+	}
+	return nil
+}
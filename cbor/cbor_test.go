@@ -0,0 +1,259 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// examples of RFC 8949 Appendix A
+var decodeTests = []struct {
+	hex  string
+	want interface{}
+}{
+	// integers
+	{"00", int64(0)},
+	{"01", int64(1)},
+	{"0a", int64(10)},
+	{"17", int64(23)},
+	{"1818", int64(24)},
+	{"1819", int64(25)},
+	{"1864", int64(100)},
+	{"1903e8", int64(1000)},
+	{"1a000f4240", int64(1000000)},
+	{"1b000000e8d4a51000", int64(1000000000000)},
+	{"1bffffffffffffffff", uint64(18446744073709551615)},
+	{"20", int64(-1)},
+	{"29", int64(-10)},
+	{"3863", int64(-100)},
+	{"3903e7", int64(-1000)},
+	{"c249010000000000000000", Tag{2, []byte{0x01, 0, 0, 0, 0, 0, 0, 0, 0}}},
+	{"c349010000000000000000", Tag{3, []byte{0x01, 0, 0, 0, 0, 0, 0, 0, 0}}},
+
+	// floats
+	{"f90000", 0.0},
+	{"f98000", math.Copysign(0, -1)},
+	{"f93c00", 1.0},
+	{"fb3ff199999999999a", 1.1},
+	{"f93e00", 1.5},
+	{"f97bff", 65504.0},
+	{"fa47c35000", 100000.0},
+	{"fa7f7fffff", 3.4028234663852886e+38},
+	{"fb7e37e43c8800759c", 1.0e+300},
+	{"f90001", 5.960464477539063e-8},
+	{"f90400", 0.00006103515625},
+	{"f9c400", -4.0},
+	{"fbc010666666666666", -4.1},
+	{"f97c00", math.Inf(1)},
+	{"f97e00", math.NaN()},
+	{"f9fc00", math.Inf(-1)},
+	{"fa7f800000", math.Inf(1)},
+	{"fa7fc00000", math.NaN()},
+	{"faff800000", math.Inf(-1)},
+	{"fb7ff0000000000000", math.Inf(1)},
+	{"fb7ff8000000000000", math.NaN()},
+	{"fbfff0000000000000", math.Inf(-1)},
+
+	// simple values
+	{"f4", false},
+	{"f5", true},
+	{"f6", nil},
+	{"f7", Undefined{}},
+
+	// tags
+	{"c074323031332d30332d32315432303a30343a30305a", Tag{0, "2013-03-21T20:04:00Z"}},
+	{"c11a514b67b0", Tag{1, int64(1363896240)}},
+	{"c1fb41d452d9ec200000", Tag{1, 1363896240.5}},
+	{"d74401020304", Tag{23, []byte{1, 2, 3, 4}}},
+	{"d818456449455446", Tag{24, []byte("dIETF")}},
+	{"d82076687474703a2f2f7777772e6578616d706c652e636f6d", Tag{32, "http://www.example.com"}},
+
+	// strings
+	{"40", []byte{}},
+	{"4401020304", []byte{1, 2, 3, 4}},
+	{"60", ""},
+	{"6161", "a"},
+	{"6449455446", "IETF"},
+	{"62225c", "\"\\"},
+	{"62c3bc", "ü"},
+	{"63e6b0b4", "水"},
+	{"64f0908591", "\U00010151"},
+
+	// arrays and maps
+	{"80", []interface{}{}},
+	{"83010203", []interface{}{int64(1), int64(2), int64(3)}},
+	{"8301820203820405", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+	{"98190102030405060708090a0b0c0d0e0f101112131415161718181819", ints(1, 25)},
+	{"a0", map[interface{}]interface{}{}},
+	{"a201020304", map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)}},
+	{"a26161016162820203", map[interface{}]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+	{"826161a161626163", []interface{}{"a", map[interface{}]interface{}{"b": "c"}}},
+	{"a56161614161626142616361436164614461656145", map[interface{}]interface{}{"a": "A", "b": "B", "c": "C", "d": "D", "e": "E"}},
+
+	// indefinite lengths
+	{"5f42010243030405ff", []byte{1, 2, 3, 4, 5}},
+	{"7f657374726561646d696e67ff", "streaming"},
+	{"9fff", []interface{}{}},
+	{"9f018202039f0405ffff", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+	{"9f01820203820405ff", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+	{"83018202039f0405ff", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+	{"83019f0203ff820405", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+	{"9f0102030405060708090a0b0c0d0e0f101112131415161718181819ff", ints(1, 25)},
+	{"bf61610161629f0203ffff", map[interface{}]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+	{"826161bf61626163ff", []interface{}{"a", map[interface{}]interface{}{"b": "c"}}},
+	{"bf6346756ef563416d7421ff", map[interface{}]interface{}{"Fun": true, "Amt": int64(-2)}},
+}
+
+func ints(from, to int64) []interface{} {
+	var a []interface{}
+	for i := from; i <= to; i++ {
+		a = append(a, i)
+	}
+	return a
+}
+
+func TestDecode(t *testing.T) {
+	for _, tt := range decodeTests {
+		t.Run(tt.hex, func(t *testing.T) {
+			b, _ := hex.DecodeString(tt.hex)
+			got, err := Decode(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f, ok := tt.want.(float64); ok {
+				g, ok := got.(float64)
+				if !ok || !(g == f && math.Signbit(g) == math.Signbit(f) || math.IsNaN(g) && math.IsNaN(f)) {
+					t.Errorf("got %#v, want %#v", got, tt.want)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	tests := []struct {
+		hex string
+		err string
+	}{
+		{"", "unexpected end"},
+		{"18", "unexpected end"},
+		{"62c3", "unexpected end"},
+		{"830102", "unexpected end"},
+		{"a201", "unexpected end"},
+		{"9f01", "unexpected end"},
+		{"0001", "extra data"},
+		{"1c", "invalid additional information"},
+		{"ff", "unexpected break"},
+		{"3bffffffffffffffff", "too small negative integer"},
+		{"f0", "unsupported simple value"},
+		{"f8ff", "unsupported simple value"},
+		{"5f6161ff", "invalid chunk"},
+		{"5f5f4101ffff", "invalid chunk"},
+		{"a1800102", "unsupported key"},
+		{strings.Repeat("81", maxDepth+1) + "00", "too deep"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hex, func(t *testing.T) {
+			b, _ := hex.DecodeString(tt.hex)
+			_, err := Decode(b)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	// the examples in the deterministic encoding; the floats are encoded
+	// in 64 bits
+	tests := []struct {
+		v   interface{}
+		hex string
+	}{
+		{int64(0), "00"},
+		{23, "17"},
+		{24, "1818"},
+		{int64(1000), "1903e8"},
+		{int64(1000000), "1a000f4240"},
+		{int64(1000000000000), "1b000000e8d4a51000"},
+		{uint64(18446744073709551615), "1bffffffffffffffff"},
+		{int64(-1), "20"},
+		{-100, "3863"},
+		{int64(-1000), "3903e7"},
+		{int64(math.MinInt64), "3b7fffffffffffffff"},
+		{1.1, "fb3ff199999999999a"},
+		{1.0e+300, "fb7e37e43c8800759c"},
+		{-4.1, "fbc010666666666666"},
+		{false, "f4"},
+		{true, "f5"},
+		{nil, "f6"},
+		{Undefined{}, "f7"},
+		{Tag{0, "2013-03-21T20:04:00Z"}, "c074323031332d30332d32315432303a30343a30305a"},
+		{Tag{2, []byte{0x01, 0, 0, 0, 0, 0, 0, 0, 0}}, "c249010000000000000000"},
+		{[]byte{}, "40"},
+		{[]byte{1, 2, 3, 4}, "4401020304"},
+		{"", "60"},
+		{"\"\\", "62225c"},
+		{"\U00010151", "64f0908591"},
+		{[]interface{}{}, "80"},
+		{[]interface{}{1, []interface{}{2, 3}, []interface{}{4, 5}}, "8301820203820405"},
+		{ints(1, 25), "98190102030405060708090a0b0c0d0e0f101112131415161718181819"},
+		{map[interface{}]interface{}{}, "a0"},
+		{map[interface{}]interface{}{int64(3): int64(4), int64(1): int64(2)}, "a201020304"},
+		{map[string]interface{}{"b": []interface{}{2, 3}, "a": 1}, "a26161016162820203"},
+		{map[string]interface{}{"e": "E", "d": "D", "c": "C", "b": "B", "a": "A"}, "a56161614161626142616361436164614461656145"},
+		// shorter keys first
+		{map[string]interface{}{"aa": 1, "b": 2, "a": 3}, "a361610361620262616101"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hex, func(t *testing.T) {
+			got, err := Encode(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, _ := hex.DecodeString(tt.hex); !bytes.Equal(got, want) {
+				t.Errorf("got %x, want %s", got, tt.hex)
+			}
+		})
+	}
+
+	if _, err := Encode(struct{}{}); err == nil {
+		t.Errorf("expected error of unsupported type")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, tt := range decodeTests {
+		t.Run(tt.hex, func(t *testing.T) {
+			b, _ := hex.DecodeString(tt.hex)
+			v, err := Decode(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e, err := Encode(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Decode(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f, ok := v.(float64); ok && math.IsNaN(f) {
+				if g, ok := got.(float64); !ok || !math.IsNaN(g) {
+					t.Errorf("got %#v, want NaN", got)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, v) {
+				t.Errorf("got %#v, want %#v", got, v)
+			}
+		})
+	}
+}
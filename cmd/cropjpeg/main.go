@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"os"
+
+	"github.com/ysh86/lspic/jpeg"
+)
+
+func main() {
+	// args
+	var (
+		srcFile   string
+		dstFile   string
+		geometry  string
+		thumbnail bool
+	)
+	flag.StringVar(&dstFile, "o", "", "dst file (default: src file + \".cropped.jpg\")")
+	flag.StringVar(&geometry, "crop", "", "rectangle to crop: `WxH+X+Y`")
+	flag.BoolVar(&thumbnail, "thumb", false, "regenerate the Exif thumbnail")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "  string")
+		fmt.Fprintln(os.Stderr, "\tsrc file")
+	}
+	flag.Parse()
+	if flag.NArg() < 1 || geometry == "" {
+		flag.Usage()
+		return
+	}
+	srcFile = flag.Arg(0)
+	if dstFile == "" {
+		dstFile = srcFile + ".cropped.jpg"
+	}
+
+	var w, h, x, y int
+	if _, err := fmt.Sscanf(geometry, "%dx%d+%d+%d", &w, &h, &x, &y); err != nil {
+		panic(fmt.Errorf("invalid rectangle: %s", geometry))
+	}
+
+	file, err := os.Open(srcFile)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		panic(err)
+	}
+
+	jpegFile, err := jpeg.NewFile(io.NewSectionReader(file, 0, stat.Size()))
+	if err != nil {
+		panic(err)
+	}
+	if err := jpegFile.Parse(); err != nil {
+		panic(err)
+	}
+
+	dst, err := os.Create(dstFile)
+	if err != nil {
+		panic(err)
+	}
+	defer dst.Close()
+	r, err := jpegFile.Crop(dst, image.Rect(x, y, x+w, y+h), thumbnail)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("cropped: %dx%d+%d+%d\n", r.Dx(), r.Dy(), r.Min.X, r.Min.Y)
+}
@@ -1,30 +1,68 @@
 package main
 
 import (
-	"encoding/base64"
-	"encoding/binary"
-	"encoding/xml"
+	"crypto/x509"
+	"flag"
 	"fmt"
+	"image"
+	"image/png"
 	"io"
 	"os"
 	"strings"
 
+	"github.com/ysh86/lspic/auximage"
+	"github.com/ysh86/lspic/c2pa"
+	"github.com/ysh86/lspic/container"
+	"github.com/ysh86/lspic/depthmap"
+	"github.com/ysh86/lspic/forensics"
+	"github.com/ysh86/lspic/gainmap"
 	"github.com/ysh86/lspic/jpeg"
+	"github.com/ysh86/lspic/motionphoto"
+	"github.com/ysh86/lspic/seft"
+	"github.com/ysh86/lspic/xmp"
 )
 
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"video/mp4":  ".mp4",
+}
+
 func main() {
 	// args
 	var (
-		srcFile string
+		srcFile   string
+		dumpThumb bool
+		dumpDepth bool
+		hdrBoost  float64
+		forensic  bool
+		qdbFile   string
+		content   bool
+		dumpSEFT  bool
+		rootsFile string
+		repair    bool
 	)
-	if len(os.Args) > 1 && os.Args[1] != "-h" {
-		srcFile = os.Args[1]
-	} else {
+	flag.BoolVar(&dumpThumb, "thumb", false, "export JFIF/JFXX thumbnails")
+	flag.BoolVar(&dumpDepth, "depth", false, "export metric depth (16-bit PNG in mm, float32) and PLY point cloud")
+	flag.Float64Var(&hdrBoost, "hdr", 0, "reconstruct HDR image (PFM) for the display `boost` from the gain map")
+	flag.BoolVar(&forensic, "forensic", false, "analyze double compression, quality and quantization tables")
+	flag.StringVar(&qdbFile, "qdb", "", "database `file` of the quantization tables of the cameras for -forensic (make<TAB>model<TAB>signature)")
+	flag.BoolVar(&content, "hash", false, "print the content hash (SHA-256) of the image data excluding the metadata")
+	flag.BoolVar(&dumpSEFT, "seft", false, "export the entries of the Samsung trailer (SEFT)")
+	flag.StringVar(&rootsFile, "roots", "", "PEM `file` of the trusted root certificates to verify the C2PA signers")
+	flag.BoolVar(&repair, "repair", false, "salvage the truncated or damaged file into src file + \".repaired.jpg\" and report the fixes")
+	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
 		fmt.Fprintln(os.Stderr, "  string")
 		fmt.Fprintln(os.Stderr, "\tsrc file")
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
 		return
 	}
+	srcFile = flag.Arg(0)
 
 	file, err := os.Open(srcFile)
 	if err != nil {
@@ -41,13 +79,32 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+
+	// repair
+	if repair {
+		dstFile := srcFile + ".repaired.jpg"
+		w, err := os.Create(dstFile)
+		if err != nil {
+			panic(err)
+		}
+		fixes, err := jpegFile.Repair(w)
+		w.Close()
+		for _, fix := range fixes {
+			fmt.Printf("fix: %s\n", fix)
+		}
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("repaired: %s\n", dstFile)
+		return
+	}
+
 	if err := jpegFile.Parse(); err != nil {
 		panic(err)
 	}
 
 	// dump
 	hasXMP := false
-	var dataSeg *jpeg.Segment
 	nextShouldBeEOI := false
 	for _, seg := range jpegFile.Segments {
 		seg.Dump()
@@ -64,10 +121,167 @@ func main() {
 		}
 
 		if seg.Marker == jpeg.Data {
-			dataSeg = seg
 			nextShouldBeEOI = true
 		}
 	}
+	if colorModel, err := jpegFile.ColorModel(); err != nil {
+		fmt.Fprintf(os.Stderr, "color model: %v\n", err)
+	} else {
+		fmt.Printf("color model: %s\n", colorModel)
+	}
+
+	// content hash
+	if content {
+		sum, err := jpegFile.ContentHash()
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("content hash: %x\n", sum)
+	}
+
+	// forensic analysis
+	if forensic {
+		var db forensics.Signatures
+		if qdbFile != "" {
+			qdb, err := os.Open(qdbFile)
+			if err != nil {
+				panic(err)
+			}
+			db, err = forensics.LoadSignatures(qdb)
+			qdb.Close()
+			if err != nil {
+				panic(err)
+			}
+		}
+		report, err := forensics.Analyze(jpegFile, db)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("forensic:\n%s", report)
+	}
+
+	// dump thumbnails
+	if dumpThumb {
+		for i, app0 := range jpegFile.JFIF() {
+			if !app0.HasThumbnail() {
+				continue
+			}
+			if err := dumpThumbnail(fmt.Sprintf("%s.thumb%d", srcFile, i), app0); err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	// dump MPF
+	if jpegFile.MPF() != nil {
+		// The malformed MPF or auxiliary images don't stop the listing.
+		images, err := jpegFile.MPImages()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "MPF: %v\n", err)
+		}
+		auxImages, err := auximage.Find(jpegFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Aux: %v\n", err)
+		}
+		suffix := make(map[int]string)
+		for _, aux := range auxImages {
+			fmt.Fprintf(os.Stderr, "Aux: %d: %s (%s)\n", aux.Index, aux.Label, aux.Type)
+			aux.Properties.Walk(func(path string, prop *xmp.Property) {
+				if prop.Kind == xmp.Simple {
+					fmt.Fprintf(os.Stderr, "  %s = %s\n", path, prop.Value)
+				}
+			})
+			suffix[aux.Index] = "." + safeName(aux.Label)
+		}
+
+		for i, img := range images {
+			fmt.Fprintf(os.Stderr, "MPF: %d: %s, %d[bytes], offset=%08x, attributes=%d\n",
+				i, img.TypeName(), img.Size, img.FileOffset, len(img.Attributes))
+			if img.FileOffset == 0 {
+				// primary image
+				continue
+			}
+
+			f, err := os.Create(fmt.Sprintf("%s.mpf%d%s.jpg", srcFile, i, suffix[i]))
+			if err != nil {
+				panic(err)
+			}
+			_, err = io.Copy(f, jpegFile.Section(img.FileOffset, img.Size))
+			if err != nil {
+				panic(err)
+			}
+			f.Close()
+		}
+	}
+
+	// Gain Map
+	gm, err := gainmap.Find(jpegFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gain map: %v\n", err)
+	}
+	if gm != nil {
+		fmt.Printf("gain map: offset=%08x, %d[bytes]\n", gm.Offset, gm.Length)
+		fmt.Print(gm.Metadata)
+		if hdrBoost > 0 {
+			if err := dumpHDR(srcFile+".hdr.pfm", file, gm, hdrBoost); err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	// Samsung trailer
+	sd, err := seft.Find(jpegFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "SEFT: %v\n", err)
+	}
+	if sd != nil {
+		fmt.Printf("SEFT: version=%d, offset=%08x\n", sd.Version, sd.Offset)
+		for i, e := range sd.Entries {
+			fmt.Printf("  %s: type=%04x, offset=%08x, %d[bytes]\n", e.Name, e.Type, e.Offset, e.Length)
+			if !dumpSEFT {
+				continue
+			}
+			f, err := os.Create(fmt.Sprintf("%s.seft%d.%s.bin", srcFile, i, safeName(e.Name)))
+			if err != nil {
+				panic(err)
+			}
+			_, err = io.Copy(f, e.Data)
+			if err != nil {
+				panic(err)
+			}
+			f.Close()
+		}
+	}
+
+	// C2PA
+	store, err := c2pa.Find(jpegFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "C2PA: %v\n", err)
+	}
+	if store != nil {
+		fmt.Printf("C2PA:\n%s", store)
+
+		var roots *x509.CertPool
+		if rootsFile != "" {
+			pem, err := os.ReadFile(rootsFile)
+			if err != nil {
+				panic(err)
+			}
+			roots = x509.NewCertPool()
+			if !roots.AppendCertsFromPEM(pem) {
+				panic(fmt.Errorf("no certificate in %s", rootsFile))
+			}
+		}
+		manifest := ""
+		for _, r := range store.Verify(jpegFile.Section(0, jpegFile.Size()), roots) {
+			if r.Manifest != manifest {
+				manifest = r.Manifest
+				fmt.Printf("  validation of %s:\n", manifest)
+			}
+			fmt.Printf("    %s\n", r)
+		}
+	}
+
 	if !hasXMP {
 		return
 	}
@@ -79,13 +293,15 @@ func main() {
 	}
 	defer fxmp.Close()
 
-	for _, seg := range jpegFile.Segments {
-		if seg.HasXMP() {
-			_, err := seg.SplitTo(fxmp, 0, -1)
-			if err != nil {
-				panic(err)
-			}
-		}
+	x, err := jpegFile.XMP()
+	if err != nil {
+		panic(err)
+	}
+	if x.GUID != "" {
+		fmt.Fprintf(os.Stderr, "ExtendedXMP: %s, %d[bytes]\n", x.GUID, len(x.Extended))
+	}
+	if _, err := fxmp.Write(x.Bytes()); err != nil {
+		panic(err)
 	}
 
 	// XML:
@@ -195,181 +411,213 @@ func main() {
 		</x:xmpmeta>
 	*/
 
-	type XMP struct {
-		XMLName xml.Name `xml:"adobe:ns:meta/ xmpmeta"`
-
-		RDF struct {
-			Description struct {
-				DepthMime   string  `xml:"http://ns.google.com/photos/1.0/depthmap/ Mime,attr"`
-				DepthFormat string  `xml:"http://ns.google.com/photos/1.0/depthmap/ Format,attr"`
-				DepthNear   float64 `xml:"http://ns.google.com/photos/1.0/depthmap/ Near,attr"`
-				DepthFar    float64 `xml:"http://ns.google.com/photos/1.0/depthmap/ Far,attr"`
-				DepthData   string  `xml:"http://ns.google.com/photos/1.0/depthmap/ Data,attr"`
-				ImageMime   string  `xml:"http://ns.google.com/photos/1.0/image/ Mime,attr"`
-				ImageData   string  `xml:"http://ns.google.com/photos/1.0/image/ Data,attr"`
-
-				Container struct {
-					Directory struct {
-						Seq struct {
-							List []struct {
-								Item struct {
-									Mime    string `xml:"http://ns.google.com/photos/dd/1.0/item/ Mime,attr"`
-									Length  int64  `xml:"http://ns.google.com/photos/dd/1.0/item/ Length,attr"`
-									DataURI string `xml:"http://ns.google.com/photos/dd/1.0/item/ DataURI,attr"`
-
-									offset int64
-								} `xml:"http://ns.google.com/photos/dd/1.0/container/ Item"`
-							} `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# li"`
-						} `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# Seq"`
-					} `xml:"http://ns.google.com/photos/dd/1.0/container/ Directory"`
-				} `xml:"http://ns.google.com/photos/dd/1.0/device/ Container"`
-			} `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# Description"`
-		} `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# RDF"`
-	}
-
-	_, err = fxmp.Seek(0, io.SeekStart)
+	packet, err := xmp.Parse(x.Bytes())
 	if err != nil {
 		panic(err)
 	}
+	fmt.Println("XMP:")
+	packet.Walk(func(path string, prop *xmp.Property) {
+		if prop.Kind != xmp.Simple {
+			return
+		}
+		value := prop.Value
+		if len(value) > 64 {
+			value = fmt.Sprintf("%s... (%d bytes)", value[:64], len(value))
+		}
+		fmt.Printf("  %s = %s\n", path, value)
+	})
 
-	xmps := make([]*XMP, 0, 2)
-	dec := xml.NewDecoder(fxmp)
-	for {
-		xmp := &XMP{}
-		err := dec.Decode(xmp)
+	// Motion Photo
+	motion, err := motionphoto.Find(jpegFile, packet)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Motion Photo: %v\n", err)
+	}
+	if motion != nil {
+		fmt.Fprintf(os.Stderr, "Motion Photo: version=%d, timestamp=%d[us], offset=%08x, %d[bytes]\n",
+			motion.Version, motion.PresentationTimestampUs, motion.Offset, motion.Length)
+		f, err := os.Create(srcFile + ".mp4")
 		if err != nil {
-			break
+			panic(err)
 		}
-		xmps = append(xmps, xmp)
-	}
-
-	// Newer format
-	if len(xmps) > 1 && len(xmps[1].RDF.Description.Container.Directory.Seq.List) == 4 {
-		li := xmps[1].RDF.Description.Container.Directory.Seq.List
-
-		// Validate
-		if li[0].Item.Mime != "image/jpeg" ||
-			li[1].Item.Mime != "image/jpeg" ||
-			li[2].Item.Mime != "image/jpeg" ||
-			li[3].Item.Mime != "image/jpeg" ||
-			li[0].Item.Length != 0 ||
-			li[1].Item.Length <= 0 ||
-			li[2].Item.Length <= 0 ||
-			li[3].Item.Length <= 0 ||
-			li[0].Item.DataURI != "primary_image" ||
-			li[1].Item.DataURI != "android/original_image" ||
-			li[2].Item.DataURI != "android/depthmap" ||
-			li[3].Item.DataURI != "android/confidencemap" {
-			panic(fmt.Errorf("unknown XMP format"))
+		if _, err := io.Copy(f, motion.Video); err != nil {
+			panic(err)
 		}
+		f.Close()
+	}
 
-		length0 := dataSeg.Length + 2 /*EOI*/ - li[3].Item.Length - li[2].Item.Length - li[1].Item.Length
-		li[0].Item.offset = 0
-		li[1].Item.offset = length0
-		li[2].Item.offset = length0 + li[1].Item.Length
-		li[3].Item.offset = length0 + li[1].Item.Length + li[2].Item.Length
-
+	// Container
+	directory, err := container.Parse(jpegFile, packet)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Container: %v\n", err)
+	}
+	if directory != nil {
 		// dump
-		for i, l := range li {
-			fmt.Fprintf(os.Stderr, "Container: %d: %v\n", i, l.Item)
+		for i, l := range directory.Items {
+			fmt.Fprintf(os.Stderr, "Container: %d: mime=%s, semantic=%s, uri=%s, offset=%08x, %d[bytes], padding=%d\n",
+				i, l.Mime, l.Semantic, l.DataURI, l.Offset, l.Length, l.Padding)
 
-			if l.Item.DataURI == "primary_image" {
+			if i == 0 {
+				// primary image
 				continue
 			}
-			names := strings.Split(l.Item.DataURI, "/")
-			name := srcFile + "." + names[1] + ".jpg"
+			if motion != nil && l.Semantic == container.SemanticMotionPhoto {
+				// already dumped
+				continue
+			}
+			name := l.Semantic
+			if l.DataURI != "" {
+				names := strings.Split(l.DataURI, "/")
+				name = names[len(names)-1]
+			}
+			ext, ok := extensions[l.Mime]
+			if !ok {
+				ext = ".bin"
+			}
 
-			f, err := os.Create(name)
+			f, err := os.Create(fmt.Sprintf("%s.%d.%s%s", srcFile, i, safeName(name), ext))
 			if err != nil {
 				panic(err)
 			}
-			written, err := dataSeg.SplitTo(f, l.Item.offset, l.Item.Length)
-			if err == io.EOF && l.Item.Length-written == 2 {
-				// add EOI
-				binary.Write(f, binary.BigEndian, jpeg.EOI)
-				err = nil
-			}
+			_, err = io.Copy(f, l.Reader)
 			if err != nil {
 				panic(err)
 			}
 			f.Close()
 		}
-
-		return
 	}
 
-	// Validate
-	if len(xmps) != 2 ||
-		len(xmps[1].RDF.Description.DepthData) == 0 ||
-		len(xmps[1].RDF.Description.ImageData) == 0 ||
-		(xmps[0].RDF.Description.DepthMime != "image/jpeg" &&
-			xmps[1].RDF.Description.DepthMime != "image/jpeg" &&
-			xmps[0].RDF.Description.DepthMime != "image/png" &&
-			xmps[1].RDF.Description.DepthMime != "image/png") ||
-		(xmps[0].RDF.Description.ImageMime != "image/jpeg" && xmps[1].RDF.Description.ImageMime != "image/jpeg") {
-		fmt.Fprintln(os.Stderr, "Unknown XMP format or No XMP")
+	// Depth Map
+	depth, img, err := depthmap.Find(jpegFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "depth map: %v\n", err)
+	}
+	if depth == nil {
 		return
 	}
+	fmt.Printf("depth map: format=%s, near=%f, far=%f, units=%s, measure=%s\n",
+		depth.Format, depth.Near, depth.Far, depth.Units, depth.MeasureType)
+	if err := dumpData(srcFile+".depth", depth.Mime, depth.Data); err != nil {
+		panic(err)
+	}
+	if depth.Confidence != nil {
+		if err := dumpData(srcFile+".confidence", depth.ConfidenceMime, depth.Confidence); err != nil {
+			panic(err)
+		}
+	}
+	if img != nil {
+		if err := dumpData(srcFile+".image", img.Mime, img.Data); err != nil {
+			panic(err)
+		}
+	}
 
-	// merge
-	xmp := xmps[0]
-	if xmp.RDF.Description.DepthMime == "" {
-		xmp.RDF.Description.DepthMime = xmps[1].RDF.Description.DepthMime
+	if dumpDepth {
+		if err := dumpMetricDepth(srcFile, file, depth); err != nil {
+			panic(err)
+		}
 	}
-	if xmp.RDF.Description.ImageMime == "" {
-		xmp.RDF.Description.ImageMime = xmps[1].RDF.Description.ImageMime
+}
+
+func dumpMetricDepth(name string, file io.ReadSeeker, depth *depthmap.DepthMap) error {
+	d, err := depth.Depth()
+	if err != nil {
+		return err
 	}
-	if xmp.RDF.Description.DepthFormat == "" {
-		xmp.RDF.Description.DepthFormat = xmps[1].RDF.Description.DepthFormat
+
+	f, err := os.Create(name + ".depth.f32")
+	if err != nil {
+		return err
 	}
-	if xmp.RDF.Description.DepthNear == 0.0 {
-		xmp.RDF.Description.DepthNear = xmps[1].RDF.Description.DepthNear
+	defer f.Close()
+	if err := d.WriteFloat32(f); err != nil {
+		return err
 	}
-	if xmp.RDF.Description.DepthFar == 0.0 {
-		xmp.RDF.Description.DepthFar = xmps[1].RDF.Description.DepthFar
+	fmt.Printf("depth: %dx%d float32\n", d.Width, d.Height)
+
+	if mm, err := d.Millimeters(); err != nil {
+		fmt.Fprintf(os.Stderr, "depth: %v\n", err)
+	} else {
+		f, err := os.Create(name + ".depth16.png")
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := png.Encode(f, mm); err != nil {
+			return err
+		}
 	}
-	xmp.RDF.Description.DepthData = xmps[1].RDF.Description.DepthData
-	xmp.RDF.Description.ImageData = xmps[1].RDF.Description.ImageData
 
-	depthData, err := base64.StdEncoding.DecodeString(xmp.RDF.Description.DepthData)
+	if depth.Intrinsics == nil {
+		return nil
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	primary, _, err := image.Decode(file)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	imageData, err := base64.StdEncoding.DecodeString(xmp.RDF.Description.ImageData)
+	ply, err := os.Create(name + ".ply")
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer ply.Close()
+	return depthmap.WritePLY(ply, d, depth.Intrinsics, primary)
+}
 
-	// dump
-	var depthName string
-	if xmp.RDF.Description.DepthMime == "image/jpeg" {
-		depthName = srcFile + ".depth.jpg"
-	} else {
-		depthName = srcFile + ".depth.png"
+func dumpHDR(name string, file io.ReadSeeker, gm *gainmap.GainMap, boost float64) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
 	}
-	fdepth, err := os.Create(depthName)
+	base, _, err := image.Decode(file)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer fdepth.Close()
-	_, err = fdepth.Write(depthData)
+	hdr, err := gm.HDR(base, boost)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	fimage, err := os.Create(srcFile + ".image.jpg")
+	f, err := os.Create(name)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer fimage.Close()
-	_, err = fimage.Write(imageData)
+	defer f.Close()
+	return hdr.WritePFM(f)
+}
+
+func dumpData(name, mime string, data []byte) error {
+	ext, ok := extensions[mime]
+	if !ok {
+		ext = ".bin"
+	}
+	return os.WriteFile(name+ext, data, 0644)
+}
+
+func dumpThumbnail(name string, app0 *jpeg.APP0Data) error {
+	if data, ok := app0.ThumbnailJPEG(); ok {
+		return os.WriteFile(name+".jpg", data, 0666)
+	}
+
+	img, err := app0.Thumbnail()
 	if err != nil {
-		panic(err)
+		return err
 	}
+	f, err := os.Create(name + ".png")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return png.Encode(f, img)
+}
 
-	fmt.Printf("xmp: depth format=%s, near=%f, far=%f\n",
-		xmp.RDF.Description.DepthFormat,
-		xmp.RDF.Description.DepthNear,
-		xmp.RDF.Description.DepthFar,
-	)
+// safeName replaces the characters other than [A-Za-z0-9_.-] of the name
+// read from the file, so that it can't choose the path of the output.
+func safeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'A' <= r && r <= 'Z', 'a' <= r && r <= 'z', '0' <= r && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, name)
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
 	"os"
@@ -12,15 +13,21 @@ func main() {
 	// args
 	var (
 		srcFile string
+		content bool
 	)
-	if len(os.Args) > 1 && os.Args[1] != "-h" {
-		srcFile = os.Args[1]
-	} else {
+	flag.BoolVar(&content, "hash", false, "print the content hash (SHA-256) of the image data excluding the metadata")
+	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
 		fmt.Fprintln(os.Stderr, "  string")
 		fmt.Fprintln(os.Stderr, "\tsrc file")
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
 		return
 	}
+	srcFile = flag.Arg(0)
 
 	file, err := os.Open(srcFile)
 	if err != nil {
@@ -45,4 +52,13 @@ func main() {
 	for _, chunk := range pngFile.Chunks {
 		chunk.Dump()
 	}
+
+	// content hash
+	if content {
+		sum, err := pngFile.ContentHash()
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("content hash: %x\n", sum)
+	}
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ysh86/lspic/jpeg"
+)
+
+var transforms = map[string]jpeg.Transform{
+	"flip-h":     jpeg.FlipHorizontal,
+	"flip-v":     jpeg.FlipVertical,
+	"transpose":  jpeg.Transpose,
+	"transverse": jpeg.Transverse,
+	"rot90":      jpeg.Rotate90,
+	"rot180":     jpeg.Rotate180,
+	"rot270":     jpeg.Rotate270,
+}
+
+func main() {
+	// args
+	var (
+		srcFile   string
+		dstFile   string
+		transform string
+	)
+	flag.StringVar(&dstFile, "o", "", "dst file (default: src file + \".rotated.jpg\")")
+	flag.StringVar(&transform, "t", "auto", "`transform`: flip-h, flip-v, transpose, transverse, rot90, rot180, rot270 or auto (by the Exif orientation)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "  string")
+		fmt.Fprintln(os.Stderr, "\tsrc file")
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		return
+	}
+	srcFile = flag.Arg(0)
+	if dstFile == "" {
+		dstFile = srcFile + ".rotated.jpg"
+	}
+
+	file, err := os.Open(srcFile)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		panic(err)
+	}
+
+	jpegFile, err := jpeg.NewFile(io.NewSectionReader(file, 0, stat.Size()))
+	if err != nil {
+		panic(err)
+	}
+	if err := jpegFile.Parse(); err != nil {
+		panic(err)
+	}
+
+	var t jpeg.Transform
+	if transform == "auto" {
+		o := jpegFile.Orientation()
+		t = jpeg.TransformForOrientation(o)
+		fmt.Printf("orientation: %d\n", o)
+	} else {
+		var ok bool
+		if t, ok = transforms[transform]; !ok {
+			panic(fmt.Errorf("unknown transform: %s", transform))
+		}
+	}
+	fmt.Printf("transform: %s\n", t)
+
+	dst, err := os.Create(dstFile)
+	if err != nil {
+		panic(err)
+	}
+	defer dst.Close()
+	if err := jpegFile.Transform(dst, t); err != nil {
+		panic(err)
+	}
+}
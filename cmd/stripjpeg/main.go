@@ -0,0 +1,169 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ysh86/lspic/jpeg"
+)
+
+// kinds of the segments for -keep
+var kinds = map[string]func(s *jpeg.Segment) bool{
+	"jfif": func(s *jpeg.Segment) bool {
+		return s.Marker == jpeg.APP0 && s.Identifier() == "JFIF"
+	},
+	"jfxx": func(s *jpeg.Segment) bool {
+		return s.Marker == jpeg.APP0 && s.Identifier() == "JFXX"
+	},
+	"exif": func(s *jpeg.Segment) bool {
+		return s.Marker == jpeg.APP1 && s.Identifier() == "Exif"
+	},
+	"xmp": func(s *jpeg.Segment) bool {
+		return s.Marker == jpeg.APP1 && s.HasXMP()
+	},
+	"icc": func(s *jpeg.Segment) bool {
+		return s.Marker == jpeg.APP2 && s.Identifier() == "ICC_PROFILE"
+	},
+	"mpf": func(s *jpeg.Segment) bool {
+		return s.Marker == jpeg.APP2 && s.Identifier() == "MPF"
+	},
+	"jumbf": func(s *jpeg.Segment) bool {
+		return s.Marker == jpeg.APP11 && s.Identifier() == "JP"
+	},
+	"iptc": func(s *jpeg.Segment) bool {
+		return s.Marker == jpeg.APP13
+	},
+	"adobe": func(s *jpeg.Segment) bool {
+		return s.Marker == jpeg.APP14 && s.Identifier() == "Adobe"
+	},
+	"com": func(s *jpeg.Segment) bool {
+		return s.Marker == jpeg.COM
+	},
+}
+
+func main() {
+	// args
+	var (
+		srcFile   string
+		dstFile   string
+		keep      string
+		exifTags  string
+		keepThumb bool
+		trailer   bool
+	)
+	flag.StringVar(&dstFile, "o", "", "dst file (default: src file + \".stripped.jpg\")")
+	flag.StringVar(&keep, "keep", "jfif,exif,icc,adobe", "comma-separated `kinds` of the segments to keep: jfif, jfxx, exif, xmp, icc, mpf, jumbf, iptc, adobe, com or all")
+	flag.StringVar(&exifTags, "exif", "0x0112", "comma-separated Exif `tags` to keep, or all")
+	flag.BoolVar(&keepThumb, "thumb", false, "keep the Exif thumbnail")
+	flag.BoolVar(&trailer, "trailer", false, "keep the data after EOI")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "  string")
+		fmt.Fprintln(os.Stderr, "\tsrc file")
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		return
+	}
+	srcFile = flag.Arg(0)
+	if dstFile == "" {
+		dstFile = srcFile + ".stripped.jpg"
+	}
+
+	opts := &jpeg.StripOptions{
+		ExifThumbnail: keepThumb,
+		Trailer:       trailer,
+	}
+
+	var keepers []func(s *jpeg.Segment) bool
+	for _, k := range strings.Split(keep, ",") {
+		if k == "all" {
+			keepers = append(keepers, func(s *jpeg.Segment) bool { return true })
+			continue
+		}
+		keeper, ok := kinds[k]
+		if !ok {
+			panic(fmt.Errorf("unknown kind: %s", k))
+		}
+		keepers = append(keepers, keeper)
+	}
+	opts.Keep = func(s *jpeg.Segment) bool {
+		for _, keeper := range keepers {
+			if keeper(s) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if exifTags != "all" {
+		opts.ExifTags = make(map[uint16]bool)
+		for _, t := range strings.Split(exifTags, ",") {
+			tag, err := strconv.ParseUint(t, 0, 16)
+			if err != nil {
+				panic(fmt.Errorf("invalid tag: %s", t))
+			}
+			opts.ExifTags[uint16(tag)] = true
+		}
+	}
+
+	file, err := os.Open(srcFile)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		panic(err)
+	}
+
+	jpegFile, err := jpeg.NewFile(io.NewSectionReader(file, 0, stat.Size()))
+	if err != nil {
+		panic(err)
+	}
+	if err := jpegFile.Parse(); err != nil {
+		panic(err)
+	}
+
+	// report
+	for _, seg := range jpegFile.Segments {
+		if !seg.IsAPPn() && seg.Marker != jpeg.COM && seg.Marker != jpeg.Trailer {
+			continue
+		}
+		kept := opts.Keep(seg)
+		switch {
+		case seg.Marker == jpeg.Trailer:
+			kept = opts.Trailer
+		case seg.Marker == jpeg.APP2 && seg.Identifier() == "MPF":
+			// removed with the MP images in the trailer
+			kept = kept && opts.Trailer
+		}
+		action := "remove"
+		if kept {
+			action = "keep"
+		}
+		fmt.Printf("%s: %s %s\n", action, seg, seg.Identifier())
+	}
+
+	dst, err := os.Create(dstFile)
+	if err != nil {
+		panic(err)
+	}
+	defer dst.Close()
+	if err := jpegFile.Strip(dst, opts); err != nil {
+		panic(err)
+	}
+
+	size, err := dst.Seek(0, io.SeekCurrent)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%d -> %d[bytes]\n", stat.Size(), size)
+}
@@ -0,0 +1,145 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/ysh86/lspic/jpeg"
+	"github.com/ysh86/lspic/xmp"
+)
+
+// Item Semantic (Motion Photo)
+const (
+	SemanticPrimary     = "Primary"
+	SemanticMotionPhoto = "MotionPhoto"
+	SemanticGainMap     = "GainMap"
+)
+
+// Item is a media item in the container.
+type Item struct {
+	Mime     string
+	Semantic string
+	Length   int64
+	Padding  int64
+	DataURI  string
+
+	// position of the item in the file
+	Offset int64
+
+	Reader *io.SectionReader
+}
+
+// Directory is the directory of the media items: Container:Directory of
+// the Motion Photo format or Device:Container of the Dynamic Depth format.
+type Directory struct {
+	Items []*Item
+
+	DynamicDepth bool
+}
+
+// Parse parses the container directory in p and locates the items in f.
+// It returns nil if p has no container directory.
+//
+// The first item is the primary image at the beginning of the file, and
+// the secondary items (with their paddings) follow it in order up to the
+// end of the file.
+func Parse(f *jpeg.File, p *xmp.Packet) (*Directory, error) {
+	d := &Directory{}
+
+	var directory *xmp.Property
+	ns, itemNs := xmp.NsContainer, xmp.NsItem
+	if device := p.Property(xmp.NsDevice, "Container"); device != nil {
+		d.DynamicDepth = true
+		ns, itemNs = xmp.NsDDContainer, xmp.NsDDItem
+		directory = device.Field(ns, "Directory")
+		if directory == nil {
+			return nil, errors.New("no Container:Directory in Device:Container")
+		}
+	} else {
+		directory = p.Property(ns, "Directory")
+		if directory == nil {
+			return nil, nil
+		}
+	}
+	if !directory.IsArray() || len(directory.Items) == 0 {
+		return nil, errors.New("empty Container:Directory")
+	}
+
+	for i, li := range directory.Items {
+		prop := li.Field(ns, "Item")
+		if prop == nil {
+			return nil, fmt.Errorf("no Container:Item in Container:Directory[%d]", i+1)
+		}
+		field := func(name string) string {
+			if f := prop.Field(itemNs, name); f != nil {
+				return f.Value
+			}
+			return ""
+		}
+
+		item := &Item{
+			Mime:     field("Mime"),
+			Semantic: field("Semantic"),
+			DataURI:  field("DataURI"),
+		}
+		if item.Mime == "" {
+			return nil, fmt.Errorf("no Item:Mime in Container:Directory[%d]", i+1)
+		}
+		var err error
+		if v := field("Length"); v != "" {
+			if item.Length, err = strconv.ParseInt(v, 10, 64); err != nil || item.Length < 0 {
+				return nil, fmt.Errorf("invalid Item:Length in Container:Directory[%d]: %s", i+1, v)
+			}
+		} else if i > 0 {
+			return nil, fmt.Errorf("no Item:Length in Container:Directory[%d]", i+1)
+		}
+		if v := field("Padding"); v != "" {
+			if item.Padding, err = strconv.ParseInt(v, 10, 64); err != nil || item.Padding < 0 {
+				return nil, fmt.Errorf("invalid Item:Padding in Container:Directory[%d]: %s", i+1, v)
+			}
+		}
+
+		d.Items = append(d.Items, item)
+	}
+
+	// locate the secondary items from the end of the file
+	end := f.Size()
+	for i := len(d.Items) - 1; i > 0; i-- {
+		item := d.Items[i]
+		end -= item.Padding + item.Length
+		item.Offset = end
+		item.Reader = f.Section(item.Offset, item.Length)
+	}
+	primary := d.Items[0]
+	end -= primary.Padding
+	if end < f.End() {
+		return nil, fmt.Errorf("items overlap the primary image: %08x < %08x", end, f.End())
+	}
+	primary.Offset = 0
+	primary.Length = end
+	primary.Reader = f.Section(0, end)
+
+	return d, nil
+}
+
+// Find returns the first item of the semantic.
+func (d *Directory) Find(semantic string) *Item {
+	for _, item := range d.Items {
+		if item.Semantic == semantic {
+			return item
+		}
+	}
+	return nil
+}
+
+// FindURI returns the item referred by the URI (Dynamic Depth).
+func (d *Directory) FindURI(uri string) *Item {
+	for _, item := range d.Items {
+		if item.DataURI == uri {
+			return item
+		}
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package depthmap
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/ysh86/lspic/container"
+	"github.com/ysh86/lspic/jpeg"
+	"github.com/ysh86/lspic/xmp"
+)
+
+// Format is the conversion of the depth values into the range [0, 1].
+type Format int
+
+// Format
+const (
+	FormatUnknown Format = iota
+	RangeInverse
+	RangeLinear
+)
+
+var formatName = map[Format]string{
+	FormatUnknown: "Unknown",
+	RangeInverse:  "RangeInverse",
+	RangeLinear:   "RangeLinear",
+}
+
+// String makes Format satisfy the Stringer interface.
+func (f Format) String() string {
+	name, ok := formatName[f]
+	if !ok {
+		name = strconv.Itoa(int(f))
+	}
+	return name
+}
+
+func parseFormat(s string) (Format, error) {
+	for f, name := range formatName {
+		if f != FormatUnknown && name == s {
+			return f, nil
+		}
+	}
+	return FormatUnknown, fmt.Errorf("unknown depth format: %q", s)
+}
+
+// DepthMap is the depth map of the image.
+type DepthMap struct {
+	Format      Format
+	Near        float64
+	Far         float64
+	Units       string
+	MeasureType string
+
+	Mime string
+	Data []byte
+
+	// confidence map (nil if none)
+	ConfidenceMime string
+	Confidence     []byte
+
+	// camera intrinsics (Dynamic Depth only, nil if none)
+	Intrinsics *Intrinsics
+}
+
+// Image is the original image the depth map is associated with.
+type Image struct {
+	Mime string
+	Data []byte
+}
+
+// Packet returns the XMP of the file as a packet: the StandardXMP merged
+// with the ExtendedXMP. It returns nil if the file has no XMP.
+func Packet(f *jpeg.File) (*xmp.Packet, error) {
+	x, err := f.XMP()
+	if err != nil || x == nil {
+		return nil, err
+	}
+
+	p, err := xmp.Parse(x.Standard)
+	if err != nil {
+		return nil, err
+	}
+	if x.Extended != nil {
+		ext, err := xmp.Parse(x.Extended)
+		if err != nil {
+			return nil, err
+		}
+		p.Merge(ext)
+	}
+	return p, nil
+}
+
+// Find finds the depth map and the original image of the file.
+// It returns nil if the file has no depth map.
+//
+// Both the GDepth/GImage format, whose data are embedded in the XMP
+// (usually in the ExtendedXMP), and the Dynamic Depth format, whose data
+// are the items of Device:Container, are supported. The image is nil if
+// the file has no original image besides the primary one.
+func Find(f *jpeg.File) (*DepthMap, *Image, error) {
+	p, err := Packet(f)
+	if err != nil || p == nil {
+		return nil, nil, err
+	}
+
+	if p.Property(xmp.NsGDepth, "Data") != nil {
+		return findGDepth(p)
+	}
+	if p.Property(xmp.NsDevice, "Cameras") != nil {
+		return findDynamicDepth(f, p)
+	}
+	return nil, nil, nil
+}
+
+func findGDepth(p *xmp.Packet) (*DepthMap, *Image, error) {
+	value := func(ns, name string) string {
+		if prop := p.Property(ns, name); prop != nil {
+			return prop.Value
+		}
+		return ""
+	}
+
+	d := &DepthMap{
+		Units:       value(xmp.NsGDepth, "Units"),
+		MeasureType: value(xmp.NsGDepth, "MeasureType"),
+		Mime:        value(xmp.NsGDepth, "Mime"),
+	}
+	if err := d.setRange(value(xmp.NsGDepth, "Format"), value(xmp.NsGDepth, "Near"), value(xmp.NsGDepth, "Far")); err != nil {
+		return nil, nil, err
+	}
+	if d.Mime != "image/jpeg" && d.Mime != "image/png" {
+		return nil, nil, fmt.Errorf("unsupported GDepth:Mime: %q", d.Mime)
+	}
+
+	var err error
+	if d.Data, err = base64.StdEncoding.DecodeString(value(xmp.NsGDepth, "Data")); err != nil {
+		return nil, nil, fmt.Errorf("invalid GDepth:Data: %w", err)
+	}
+	if v := value(xmp.NsGDepth, "Confidence"); v != "" {
+		d.ConfidenceMime = value(xmp.NsGDepth, "ConfidenceMime")
+		if d.Confidence, err = base64.StdEncoding.DecodeString(v); err != nil {
+			return nil, nil, fmt.Errorf("invalid GDepth:Confidence: %w", err)
+		}
+	}
+
+	var img *Image
+	if v := value(xmp.NsGImage, "Data"); v != "" {
+		img = &Image{Mime: value(xmp.NsGImage, "Mime")}
+		if img.Data, err = base64.StdEncoding.DecodeString(v); err != nil {
+			return nil, nil, fmt.Errorf("invalid GImage:Data: %w", err)
+		}
+	}
+
+	return d, img, nil
+}
+
+func findDynamicDepth(f *jpeg.File, p *xmp.Packet) (*DepthMap, *Image, error) {
+	dir, err := container.Parse(f, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dir == nil {
+		return nil, nil, errors.New("no Device:Container")
+	}
+
+	// the first camera with a depth map
+	var depth, image, model *xmp.Property
+	for _, li := range p.Property(xmp.NsDevice, "Cameras").Items {
+		camera := li.Field(xmp.NsDevice, "Camera")
+		if camera == nil {
+			continue
+		}
+		if depth = camera.Field(xmp.NsCamera, "DepthMap"); depth != nil {
+			image = camera.Field(xmp.NsCamera, "Image")
+			model = camera.Field(xmp.NsCamera, "ImagingModel")
+			break
+		}
+	}
+	if depth == nil {
+		return nil, nil, nil
+	}
+
+	value := func(prop *xmp.Property, ns, name string) string {
+		if f := prop.Field(ns, name); f != nil {
+			return f.Value
+		}
+		return ""
+	}
+	read := func(uri string) (string, []byte, error) {
+		item := dir.FindURI(uri)
+		if item == nil {
+			return "", nil, fmt.Errorf("no item of %q in Device:Container", uri)
+		}
+		b, err := io.ReadAll(item.Reader)
+		return item.Mime, b, err
+	}
+
+	d := &DepthMap{
+		Units:       value(depth, xmp.NsDepthMap, "Units"),
+		MeasureType: value(depth, xmp.NsDepthMap, "MeasureType"),
+	}
+	if err := d.setRange(value(depth, xmp.NsDepthMap, "Format"), value(depth, xmp.NsDepthMap, "Near"), value(depth, xmp.NsDepthMap, "Far")); err != nil {
+		return nil, nil, err
+	}
+	if d.Mime, d.Data, err = read(value(depth, xmp.NsDepthMap, "DepthURI")); err != nil {
+		return nil, nil, err
+	}
+	if uri := value(depth, xmp.NsDepthMap, "ConfidenceURI"); uri != "" {
+		if d.ConfidenceMime, d.Confidence, err = read(uri); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if model != nil {
+		if d.Intrinsics, err = parseIntrinsics(model); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// the primary image has no URI
+	var img *Image
+	if image != nil {
+		if uri := value(image, xmp.NsImage, "ItemURI"); uri != "" {
+			img = &Image{}
+			if img.Mime, img.Data, err = read(uri); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return d, img, nil
+}
+
+func (d *DepthMap) setRange(format, near, far string) error {
+	var err error
+	if d.Format, err = parseFormat(format); err != nil {
+		return err
+	}
+	if d.Near, err = strconv.ParseFloat(near, 64); err != nil {
+		return fmt.Errorf("invalid near: %q", near)
+	}
+	if d.Far, err = strconv.ParseFloat(far, 64); err != nil {
+		return fmt.Errorf("invalid far: %q", far)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package depthmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg" // decoder
+	_ "image/png"  // decoder
+	"io"
+	"math"
+)
+
+// Depth is the decoded depth map: the depth of each pixel in the units of
+// the depth map.
+type Depth struct {
+	Width  int
+	Height int
+	Pix    []float32
+
+	Units       string
+	MeasureType string
+}
+
+// Decode decodes the depth map image.
+func (d *DepthMap) Decode() (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(d.Data))
+	return img, err
+}
+
+// Depth decodes the depth map and converts the normalized values into
+// the depths according to the format:
+//
+//	RangeInverse: d = far*near / (far - (far-near)*dn)
+//	RangeLinear:  d = dn*(far-near) + near
+func (d *DepthMap) Depth() (*Depth, error) {
+	img, err := d.Decode()
+	if err != nil {
+		return nil, err
+	}
+
+	var conv func(dn float64) float64
+	switch d.Format {
+	case RangeInverse:
+		conv = func(dn float64) float64 {
+			return d.Far * d.Near / (d.Far - (d.Far-d.Near)*dn)
+		}
+	case RangeLinear:
+		conv = func(dn float64) float64 {
+			return dn*(d.Far-d.Near) + d.Near
+		}
+	default:
+		return nil, fmt.Errorf("unsupported depth format: %s", d.Format)
+	}
+
+	b := img.Bounds()
+	depth := &Depth{
+		Width:       b.Dx(),
+		Height:      b.Dy(),
+		Pix:         make([]float32, b.Dx()*b.Dy()),
+		Units:       d.Units,
+		MeasureType: d.MeasureType,
+	}
+	i := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			g := color.Gray16Model.Convert(img.At(x, y)).(color.Gray16)
+			depth.Pix[i] = float32(conv(float64(g.Y) / 0xffff))
+			i++
+		}
+	}
+
+	return depth, nil
+}
+
+// At returns the depth at (x, y).
+func (d *Depth) At(x, y int) float32 {
+	return d.Pix[y*d.Width+x]
+}
+
+// Meters returns the length of the unit in meters, or 0 if the depth is
+// not metric.
+func (d *Depth) Meters() float64 {
+	switch d.Units {
+	case "", "m", "Meters":
+		// meters by default
+		return 1
+	case "mm", "Millimeters":
+		return 0.001
+	}
+	return 0
+}
+
+// Millimeters converts the depth into a 16-bit grayscale image in
+// millimeters. The depths out of the range are clamped.
+func (d *Depth) Millimeters() (*image.Gray16, error) {
+	scale := d.Meters() * 1000
+	if scale == 0 {
+		return nil, fmt.Errorf("not metric depth: %q", d.Units)
+	}
+
+	img := image.NewGray16(image.Rect(0, 0, d.Width, d.Height))
+	for i, v := range d.Pix {
+		mm := math.Round(float64(v) * scale)
+		if math.IsNaN(mm) || mm < 0 {
+			mm = 0
+		} else if mm > 0xffff {
+			mm = 0xffff
+		}
+		img.Pix[i*2+0] = uint8(uint16(mm) >> 8)
+		img.Pix[i*2+1] = uint8(uint16(mm))
+	}
+	return img, nil
+}
+
+// WriteFloat32 writes the depths as a raw little-endian float32 array
+// in the row-major order.
+func (d *Depth) WriteFloat32(w io.Writer) error {
+	return binary.Write(w, binary.LittleEndian, d.Pix)
+}
@@ -0,0 +1,145 @@
+package depthmap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/ysh86/lspic/xmp"
+)
+
+// Intrinsics is the pinhole camera model of Camera:ImagingModel.
+// The focal lengths and the principal point are normalized by the
+// maximum dimension of the image.
+type Intrinsics struct {
+	FocalLengthX    float64
+	FocalLengthY    float64
+	PrincipalPointX float64
+	PrincipalPointY float64
+
+	// size of the image in pixels
+	ImageWidth  int
+	ImageHeight int
+}
+
+func parseIntrinsics(model *xmp.Property) (*Intrinsics, error) {
+	float := func(name string) (float64, error) {
+		f := model.Field(xmp.NsImagingModel, name)
+		if f == nil {
+			return 0, fmt.Errorf("no ImagingModel:%s", name)
+		}
+		v, err := strconv.ParseFloat(f.Value, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ImagingModel:%s: %q", name, f.Value)
+		}
+		return v, nil
+	}
+
+	in := &Intrinsics{}
+	var err error
+	if in.FocalLengthX, err = float("FocalLengthX"); err != nil {
+		return nil, err
+	}
+	if in.FocalLengthY, err = float("FocalLengthY"); err != nil {
+		return nil, err
+	}
+	if in.PrincipalPointX, err = float("PrincipalPointX"); err != nil {
+		return nil, err
+	}
+	if in.PrincipalPointY, err = float("PrincipalPointY"); err != nil {
+		return nil, err
+	}
+	// optional
+	if w, err := float("ImageWidth"); err == nil {
+		in.ImageWidth = int(w)
+	}
+	if h, err := float("ImageHeight"); err == nil {
+		in.ImageHeight = int(h)
+	}
+
+	return in, nil
+}
+
+// WritePLY writes the depth as a point cloud in the binary PLY format.
+// The points are unprojected by the intrinsics in the units of the depth,
+// and colored from img (the primary image) if it is not nil. The pixels
+// without depth are skipped.
+func WritePLY(w io.Writer, depth *Depth, in *Intrinsics, img image.Image) error {
+	if in == nil {
+		return errors.New("no camera intrinsics")
+	}
+
+	// the normalized intrinsics apply to the depth map of the same aspect ratio
+	dim := float64(depth.Width)
+	if depth.Height > depth.Width {
+		dim = float64(depth.Height)
+	}
+	fx, fy := in.FocalLengthX*dim, in.FocalLengthY*dim
+	cx, cy := in.PrincipalPointX*dim, in.PrincipalPointY*dim
+	if fx == 0 || fy == 0 {
+		return errors.New("invalid focal length")
+	}
+	opticRay := depth.MeasureType == "OpticRay"
+
+	n := 0
+	for _, v := range depth.Pix {
+		if valid(v) {
+			n++
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "ply\nformat binary_little_endian 1.0\nelement vertex %d\n", n)
+	bw.WriteString("property float x\nproperty float y\nproperty float z\n")
+	bw.WriteString("property uchar red\nproperty uchar green\nproperty uchar blue\n")
+	bw.WriteString("end_header\n")
+
+	var b image.Rectangle
+	if img != nil {
+		b = img.Bounds()
+	}
+	var vertex [15]byte
+	for y := 0; y < depth.Height; y++ {
+		for x := 0; x < depth.Width; x++ {
+			d := depth.At(x, y)
+			if !valid(d) {
+				continue
+			}
+
+			// pixel center
+			u := (float64(x) + 0.5 - cx) / fx
+			v := (float64(y) + 0.5 - cy) / fy
+			z := float64(d)
+			if opticRay {
+				z /= math.Sqrt(1 + u*u + v*v)
+			}
+			binary.LittleEndian.PutUint32(vertex[0:], math.Float32bits(float32(u*z)))
+			binary.LittleEndian.PutUint32(vertex[4:], math.Float32bits(float32(v*z)))
+			binary.LittleEndian.PutUint32(vertex[8:], math.Float32bits(float32(z)))
+
+			c := color.RGBA{0xff, 0xff, 0xff, 0xff}
+			if img != nil {
+				px := b.Min.X + x*b.Dx()/depth.Width
+				py := b.Min.Y + y*b.Dy()/depth.Height
+				c = color.RGBAModel.Convert(img.At(px, py)).(color.RGBA)
+			}
+			vertex[12], vertex[13], vertex[14] = c.R, c.G, c.B
+
+			if _, err := bw.Write(vertex[:]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+func valid(d float32) bool {
+	return d > 0 && !math.IsInf(float64(d), 0) && !math.IsNaN(float64(d))
+}
@@ -0,0 +1,76 @@
+package forensics
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ysh86/lspic/jpeg"
+)
+
+// Signature returns the signature of the quantization tables used by the
+// planes: the first 8 bytes of SHA-1 of the tables in hex.
+func Signature(c *jpeg.Coefficients) string {
+	h := sha1.New()
+	var used [4]bool
+	for _, p := range c.Planes {
+		if used[p.Tq] {
+			continue
+		}
+		used[p.Tq] = true
+		for k := 0; k < 64; k++ {
+			binary.Write(h, binary.BigEndian, c.Quant[p.Tq][jpeg.Zigzag(k)])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// Signatures is the database of the signatures of the quantization tables
+// of the cameras.
+type Signatures map[string]map[string]bool
+
+func cameraKey(maker, model string) string {
+	return strings.ToLower(strings.TrimSpace(maker)) + "\x00" + strings.ToLower(strings.TrimSpace(model))
+}
+
+// LoadSignatures reads the database of the lines of "make<TAB>model<TAB>
+// signature". The empty lines and the lines starting with # are ignored.
+func LoadSignatures(r io.Reader) (Signatures, error) {
+	db := make(Signatures)
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid signature at line %d", n)
+		}
+		db.Add(fields[0], fields[1], strings.TrimSpace(fields[2]))
+	}
+	return db, s.Err()
+}
+
+// Add adds the signature of the camera.
+func (db Signatures) Add(maker, model, signature string) {
+	key := cameraKey(maker, model)
+	if db[key] == nil {
+		db[key] = make(map[string]bool)
+	}
+	db[key][strings.ToLower(signature)] = true
+}
+
+// Lookup reports whether the signature is known for the camera. known is
+// false if the database has no signature of the camera.
+func (db Signatures) Lookup(maker, model, signature string) (match, known bool) {
+	signatures := db[cameraKey(maker, model)]
+	if len(signatures) == 0 {
+		return false, false
+	}
+	return signatures[strings.ToLower(signature)], true
+}
@@ -0,0 +1,200 @@
+package forensics
+
+import (
+	"math"
+
+	"github.com/ysh86/lspic/jpeg"
+)
+
+const (
+	// minimum bins of the histogram of the quantized values
+	histogramBins = 40
+	// range of the dequantized values of the histogram
+	histogramRange = 400
+
+	// number of the AC coefficients analyzed in the zigzag order
+	analyzedCoefficients = 14
+
+	// minimum count of the window to use the bin
+	minWindowCount = 5
+
+	// correlation to detect the periodic artifacts
+	periodicThreshold = 0.8
+	scoreTolerance    = 0.02
+)
+
+// Periodicity is the analysis of the histogram of a DCT coefficient.
+type Periodicity struct {
+	Position int // in the natural order
+	Step     int // quantization step of the image
+
+	// Primary is the most likely step of the primary compression, and
+	// Score is the correlation of the histogram with its artifacts.
+	Primary int
+	Score   float64
+
+	Detected bool
+}
+
+// histogram returns the histogram of the absolute values of the
+// coefficient at pos in the blocks of the image (not the padding).
+func histogram(p *jpeg.Plane, pos, step int) []int {
+	bins := histogramRange / step
+	if bins < histogramBins {
+		bins = histogramBins
+	}
+
+	h := make([]int, bins+1)
+	for by := 0; by < p.ImageBlocksH; by++ {
+		for bx := 0; bx < p.ImageBlocksW; bx++ {
+			v := int(p.Block(bx, by)[pos])
+			if v < 0 {
+				v = -v
+			}
+			if v <= bins {
+				h[v]++
+			}
+		}
+	}
+	return h
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// multiplicity returns the number of the values quantized by primary
+// which are requantized into the bin k by step.
+func multiplicity(primary, step, k int) int {
+	// primary*n in [(k-1/2)*step, (k+1/2)*step)
+	lo := int(math.Ceil((float64(k) - 0.5) * float64(step) / float64(primary)))
+	hi := int(math.Ceil((float64(k) + 0.5) * float64(step) / float64(primary)))
+	return hi - lo
+}
+
+// correlation returns the correlation of the histogram normalized by its
+// envelope with the artifacts of the double quantization by primary and
+// step. It returns false if the histogram has too few samples.
+func correlation(h []int, primary, step int) (float64, bool) {
+	period := primary / gcd(primary, step)
+
+	var xs, ys []float64
+	for k := 1; k+period <= len(h); k++ {
+		// a period of the window around k
+		lo := k - period/2
+		if lo < 1 {
+			continue
+		}
+		hi := lo + period
+		if hi > len(h) {
+			break
+		}
+		count, m := 0, 0
+		for j := lo; j < hi; j++ {
+			count += h[j]
+			m += multiplicity(primary, step, j)
+		}
+		if count < minWindowCount*period || m == 0 {
+			continue
+		}
+		xs = append(xs, float64(h[k])*float64(period)/float64(count))
+		ys = append(ys, float64(multiplicity(primary, step, k))*float64(period)/float64(m))
+	}
+	if len(xs) < 2*period || len(xs) < 6 {
+		return 0, false
+	}
+
+	// Pearson
+	var mx, my float64
+	for i := range xs {
+		mx += xs[i]
+		my += ys[i]
+	}
+	mx /= float64(len(xs))
+	my /= float64(len(ys))
+	var sxy, sxx, syy float64
+	for i := range xs {
+		sxy += (xs[i] - mx) * (ys[i] - my)
+		sxx += (xs[i] - mx) * (xs[i] - mx)
+		syy += (ys[i] - my) * (ys[i] - my)
+	}
+	if sxx == 0 || syy == 0 {
+		return 0, false
+	}
+	return sxy / math.Sqrt(sxx*syy), true
+}
+
+// analyzePeriodicity finds the primary quantization step which explains
+// the periodic artifacts of the histogram of the coefficient at pos.
+func analyzePeriodicity(c *jpeg.Coefficients, pos int) *Periodicity {
+	p := c.Planes[0]
+	step := int(c.Quant[p.Tq][pos])
+	result := &Periodicity{Position: pos, Step: step}
+	if step == 0 {
+		return result
+	}
+
+	h := histogram(p, pos, step)
+	scores := make(map[int]float64)
+	for primary := 2; primary <= 3*step+32 && primary <= 255; primary++ {
+		if primary == step || primary/gcd(primary, step) < 2 {
+			// no artifacts
+			continue
+		}
+		if score, ok := correlation(h, primary, step); ok {
+			scores[primary] = score
+			if score > result.Score {
+				result.Score = score
+			}
+		}
+	}
+
+	// the divisors of the primary step can fit as well as it
+	for primary, score := range scores {
+		if score >= result.Score-scoreTolerance && primary > result.Primary {
+			result.Primary = primary
+		}
+	}
+	result.Detected = result.Score >= periodicThreshold
+	return result
+}
+
+// DoubleCompression is the result of the detection of the double JPEG
+// compression from the luminance coefficients.
+type DoubleCompression struct {
+	Coefficients []*Periodicity
+
+	Detected bool
+	// PrimaryQuality is the IJG quality of the primary compression
+	// estimated from the detected steps, or 0 if not detected.
+	PrimaryQuality int
+}
+
+// DetectDoubleCompression analyzes the histograms of the low-frequency AC
+// coefficients of the luminance. The requantization of the coefficients
+// by a different step leaves periodic peaks or empty bins in them.
+func DetectDoubleCompression(c *jpeg.Coefficients) *DoubleCompression {
+	d := &DoubleCompression{}
+	if len(c.Planes) == 0 {
+		return d
+	}
+
+	steps := make(map[int]int)
+	for k := 1; k <= analyzedCoefficients; k++ {
+		p := analyzePeriodicity(c, jpeg.Zigzag(k))
+		d.Coefficients = append(d.Coefficients, p)
+		if p.Detected {
+			steps[p.Position] = p.Primary
+		}
+	}
+
+	// a few coefficients can be periodic by chance
+	if len(steps) >= 3 && 3*len(steps) >= len(d.Coefficients) {
+		d.Detected = true
+		d.PrimaryQuality = qualityForSteps(steps)
+	}
+	return d
+}
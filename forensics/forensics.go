@@ -0,0 +1,118 @@
+package forensics
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/ysh86/lspic/jpeg"
+	"github.com/ysh86/lspic/tiff"
+)
+
+// Report is the result of the forensic analysis of a JPEG file.
+type Report struct {
+	Quality           *Quality
+	DoubleCompression *DoubleCompression
+
+	// camera declared in Exif
+	Make     string
+	Model    string
+	Software string
+
+	Signature string
+	// CameraMismatch reports that the quantization tables don't match the
+	// camera, and Reason describes why.
+	CameraMismatch bool
+	Reason         string
+
+	Thumbnails []*ThumbnailCheck
+}
+
+func exifString(dir *tiff.Directory, tag uint16) string {
+	field := dir.Field(tag)
+	if field == nil || field.Type != tiff.ASCII {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(field.Value), "\x00"))
+}
+
+// Analyze analyzes the quantization tables and the DCT coefficients of the
+// file. db is the optional database of the signatures of the cameras.
+// Without the signatures of the camera, the standard tables of libjpeg are
+// regarded as re-saved by software, because the cameras usually have
+// their own tables. The thumbnails are compared with the primary image
+// unless it can't be decoded.
+func Analyze(f *jpeg.File, db Signatures) (*Report, error) {
+	c, err := f.Coefficients()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Report{
+		Quality:           EstimateTables(c),
+		DoubleCompression: DetectDoubleCompression(c),
+		Signature:         Signature(c),
+	}
+
+	if checks, err := CheckThumbnails(f); err == nil {
+		r.Thumbnails = checks
+	}
+
+	if exif := f.Exif(); exif != nil {
+		if dir, err := exif.Directory(); err == nil {
+			r.Make = exifString(dir, tiff.Make)
+			r.Model = exifString(dir, tiff.Model)
+			r.Software = exifString(dir, tiff.Software)
+		}
+	}
+	if r.Make == "" && r.Model == "" {
+		return r, nil
+	}
+
+	if match, known := db.Lookup(r.Make, r.Model, r.Signature); known {
+		if !match {
+			r.CameraMismatch = true
+			r.Reason = "unknown tables for the camera"
+		}
+	} else if r.Quality.Standard {
+		r.CameraMismatch = true
+		r.Reason = fmt.Sprintf("standard IJG tables of quality %d", r.Quality.Luminance)
+	}
+	return r, nil
+}
+
+// String makes Report satisfy the Stringer interface.
+func (r *Report) String() string {
+	var buf bytes.Buffer
+
+	q := r.Quality
+	buf.WriteString(fmt.Sprintf("  quality: luminance=%d, chrominance=%d, standard=%v\n", q.Luminance, q.Chrominance, q.Standard))
+	buf.WriteString(fmt.Sprintf("  signature: %s\n", r.Signature))
+
+	d := r.DoubleCompression
+	buf.WriteString(fmt.Sprintf("  double compression: %v\n", d.Detected))
+	if d.Detected {
+		buf.WriteString(fmt.Sprintf("  primary quality: %d\n", d.PrimaryQuality))
+	}
+	for _, p := range d.Coefficients {
+		if p.Detected {
+			buf.WriteString(fmt.Sprintf("    (%d,%d): step=%d, primary=%d, score=%.2f\n", p.Position%8, p.Position/8, p.Step, p.Primary, p.Score))
+		}
+	}
+
+	if r.Make != "" || r.Model != "" {
+		buf.WriteString(fmt.Sprintf("  camera: %s %s\n", r.Make, r.Model))
+	}
+	if r.Software != "" {
+		buf.WriteString(fmt.Sprintf("  software: %s\n", r.Software))
+	}
+	if r.CameraMismatch {
+		buf.WriteString(fmt.Sprintf("  camera mismatch: %s\n", r.Reason))
+	}
+
+	for _, t := range r.Thumbnails {
+		buf.WriteString(fmt.Sprintf("  thumbnail %s\n", t))
+	}
+
+	return buf.String()
+}
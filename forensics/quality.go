@@ -0,0 +1,119 @@
+package forensics
+
+import "github.com/ysh86/lspic/jpeg"
+
+// standard quantization tables of Annex K in the natural order
+var standardTables = [2][64]uint16{
+	// luminance (K.1)
+	{
+		16, 11, 10, 16, 24, 40, 51, 61,
+		12, 12, 14, 19, 26, 58, 60, 55,
+		14, 13, 16, 24, 40, 57, 69, 56,
+		14, 17, 22, 29, 51, 87, 80, 62,
+		18, 22, 37, 56, 68, 109, 103, 77,
+		24, 35, 55, 64, 81, 104, 113, 92,
+		49, 64, 78, 87, 103, 121, 120, 101,
+		72, 92, 95, 98, 112, 100, 103, 99,
+	},
+	// chrominance (K.2)
+	{
+		17, 18, 24, 47, 99, 99, 99, 99,
+		18, 21, 26, 66, 99, 99, 99, 99,
+		24, 26, 56, 99, 99, 99, 99, 99,
+		47, 66, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+// standardValue returns the value of the standard table scaled for the
+// quality as libjpeg does (jpeg_quality_scaling).
+func standardValue(chroma bool, pos, quality int) int {
+	scale := 200 - 2*quality
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	base := standardTables[0][pos]
+	if chroma {
+		base = standardTables[1][pos]
+	}
+	v := (int(base)*scale + 50) / 100
+	if v < 1 {
+		v = 1
+	}
+	if v > 255 {
+		v = 255
+	}
+	return v
+}
+
+// EstimateQuality returns the IJG quality (1-100) whose scaled standard
+// table is the closest to the quantization table in the natural order.
+// exact reports that the table is identical to the scaled one.
+func EstimateQuality(table *[64]uint16, chroma bool) (quality int, exact bool) {
+	best := -1
+	for q := 1; q <= 100; q++ {
+		diff := 0
+		for pos, v := range table {
+			d := int(v) - standardValue(chroma, pos, q)
+			if d < 0 {
+				d = -d
+			}
+			diff += d
+		}
+		if best < 0 || diff < best {
+			best, quality = diff, q
+		}
+	}
+	return quality, best == 0
+}
+
+// qualityForSteps returns the IJG quality which matches the quantization
+// steps of the luminance at the positions the best.
+func qualityForSteps(steps map[int]int) int {
+	best, quality := -1, 0
+	for q := 1; q <= 100; q++ {
+		diff := 0
+		for pos, step := range steps {
+			d := step - standardValue(false, pos, q)
+			if d < 0 {
+				d = -d
+			}
+			diff += d
+		}
+		if best < 0 || diff < best {
+			best, quality = diff, q
+		}
+	}
+	return quality
+}
+
+// Quality is the estimated quality of the quantization tables.
+type Quality struct {
+	Luminance   int
+	Chrominance int // 0 for grayscale
+
+	// Standard reports that the tables are the standard ones scaled by
+	// the IJG quality, i.e. the tables of libjpeg and its derivatives.
+	Standard bool
+}
+
+// EstimateTables estimates the quality of the tables used by the planes.
+func EstimateTables(c *jpeg.Coefficients) *Quality {
+	q := &Quality{Standard: true}
+	for i, p := range c.Planes {
+		if i > 1 {
+			break
+		}
+		quality, exact := EstimateQuality(&c.Quant[p.Tq], i > 0)
+		if i == 0 {
+			q.Luminance = quality
+		} else {
+			q.Chrominance = quality
+		}
+		q.Standard = q.Standard && exact
+	}
+	return q
+}
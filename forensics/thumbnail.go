@@ -0,0 +1,226 @@
+package forensics
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	stdjpeg "image/jpeg"
+	"math/bits"
+
+	"github.com/ysh86/lspic/jpeg"
+)
+
+// thresholds of the different content
+const (
+	maxAHashDistance = 12
+	maxDHashDistance = 16
+	maxMAD           = 0.12
+
+	// size of the images compared by MAD
+	madSize = 32
+	// maximum size of the primary image resized before the comparison
+	primarySize = 256
+)
+
+// ThumbnailCheck is the difference of a thumbnail from the primary image.
+type ThumbnailCheck struct {
+	Source string // e.g. "IFD1", "APP0 0", "MPF 1"
+	Width  int
+	Height int
+
+	// Hamming distances of the 64-bit average hash and difference hash
+	AHash int
+	DHash int
+	// mean absolute difference of the luma (0-1)
+	MAD float64
+
+	// Mismatch reports that the thumbnail shows different content.
+	Mismatch bool
+}
+
+// String makes ThumbnailCheck satisfy the Stringer interface.
+func (t *ThumbnailCheck) String() string {
+	return fmt.Sprintf("%s: %dx%d, aHash=%d, dHash=%d, MAD=%.3f, mismatch=%v", t.Source, t.Width, t.Height, t.AHash, t.DHash, t.MAD, t.Mismatch)
+}
+
+// luma returns the luma of the image resized to w x h by the box filter.
+func luma(img image.Image, r image.Rectangle, w, h int) []float64 {
+	l := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		y0 := r.Min.Y + y*r.Dy()/h
+		y1 := r.Min.Y + (y+1)*r.Dy()/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0 := r.Min.X + x*r.Dx()/w
+			x1 := r.Min.X + (x+1)*r.Dx()/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var sum float64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					r, g, b, _ := img.At(sx, sy).RGBA()
+					sum += (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 0xffff
+				}
+			}
+			l[y*w+x] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+	return l
+}
+
+// shrink returns the grayscale image resized to fit in size x size.
+func shrink(img image.Image, size int) image.Image {
+	r := img.Bounds()
+	w, h := r.Dx(), r.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	if w > h {
+		w, h = size, (h*size+w/2)/w
+	} else {
+		w, h = (w*size+h/2)/h, size
+	}
+	if w == 0 {
+		w = 1
+	}
+	if h == 0 {
+		h = 1
+	}
+
+	gray := image.NewGray(image.Rect(0, 0, w, h))
+	for i, v := range luma(img, r, w, h) {
+		gray.Pix[i] = uint8(v*255 + 0.5)
+	}
+	return gray
+}
+
+// aHash is the average hash: the pixels of 8x8 brighter than the mean.
+func aHash(img image.Image, r image.Rectangle) uint64 {
+	l := luma(img, r, 8, 8)
+	var mean float64
+	for _, v := range l {
+		mean += v
+	}
+	mean /= float64(len(l))
+
+	var h uint64
+	for i, v := range l {
+		if v > mean {
+			h |= 1 << i
+		}
+	}
+	return h
+}
+
+// dHash is the difference hash: the gradients of 9x8 pixels.
+func dHash(img image.Image, r image.Rectangle) uint64 {
+	l := luma(img, r, 9, 8)
+	var h uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if l[y*9+x] < l[y*9+x+1] {
+				h |= 1 << (y*8 + x)
+			}
+		}
+	}
+	return h
+}
+
+// contentRect returns the rectangle of the thumbnail with the aspect ratio
+// of the primary image, excluding the letterbox.
+func contentRect(thumb image.Rectangle, primary image.Rectangle) image.Rectangle {
+	tw, th := thumb.Dx(), thumb.Dy()
+	pw, ph := primary.Dx(), primary.Dy()
+	if tw*ph > pw*th {
+		// pillarbox
+		w := th * pw / ph
+		if w > 0 {
+			x := thumb.Min.X + (tw-w)/2
+			return image.Rect(x, thumb.Min.Y, x+w, thumb.Max.Y)
+		}
+	} else if tw*ph < pw*th {
+		// letterbox
+		h := tw * ph / pw
+		if h > 0 {
+			y := thumb.Min.Y + (th-h)/2
+			return image.Rect(thumb.Min.X, y, thumb.Max.X, y+h)
+		}
+	}
+	return thumb
+}
+
+func compareThumbnail(source string, thumb, primary image.Image) *ThumbnailCheck {
+	t := &ThumbnailCheck{Source: source, Width: thumb.Bounds().Dx(), Height: thumb.Bounds().Dy()}
+	tr := contentRect(thumb.Bounds(), primary.Bounds())
+	pr := primary.Bounds()
+
+	t.AHash = bits.OnesCount64(aHash(thumb, tr) ^ aHash(primary, pr))
+	t.DHash = bits.OnesCount64(dHash(thumb, tr) ^ dHash(primary, pr))
+
+	lt := luma(thumb, tr, madSize, madSize)
+	lp := luma(primary, pr, madSize, madSize)
+	for i := range lt {
+		d := lt[i] - lp[i]
+		if d < 0 {
+			d = -d
+		}
+		t.MAD += d
+	}
+	t.MAD /= float64(len(lt))
+
+	t.Mismatch = t.AHash > maxAHashDistance || t.DHash > maxDHashDistance || t.MAD > maxMAD
+	return t
+}
+
+// CheckThumbnails compares the thumbnails in the file (the 1st IFD of
+// Exif, JFIF/JFXX and the large thumbnails of MPF) with the primary image,
+// and reports the perceptual differences. The thumbnails which can't be
+// decoded are skipped.
+func CheckThumbnails(f *jpeg.File) ([]*ThumbnailCheck, error) {
+	primary, err := stdjpeg.Decode(f.Section(0, f.End()))
+	if err != nil {
+		return nil, err
+	}
+	primary = shrink(primary, primarySize)
+
+	var checks []*ThumbnailCheck
+	add := func(source string, thumb image.Image, err error) {
+		if err == nil && !thumb.Bounds().Empty() {
+			checks = append(checks, compareThumbnail(source, thumb, primary))
+		}
+	}
+
+	if exif := f.Exif(); exif != nil {
+		if dir, err := exif.Directory(); err == nil && dir.Next != nil && dir.Next.Thumbnail != nil {
+			thumb, err := stdjpeg.Decode(bytes.NewReader(dir.Next.Thumbnail))
+			add("IFD1", thumb, err)
+		}
+	}
+
+	for i, app0 := range f.JFIF() {
+		if app0.HasThumbnail() {
+			thumb, err := app0.Thumbnail()
+			add(fmt.Sprintf("APP0 %d", i), thumb, err)
+		}
+	}
+
+	if f.MPF() != nil {
+		images, err := f.MPImages()
+		if err != nil {
+			return nil, err
+		}
+		for i, mp := range images {
+			if i == 0 || !mp.IsJPEG() || (mp.Type() != jpeg.MPTypeLargeThumbnailVGA && mp.Type() != jpeg.MPTypeLargeThumbnailHD) {
+				continue
+			}
+			thumb, err := stdjpeg.Decode(f.Section(mp.FileOffset, mp.Size))
+			add(fmt.Sprintf("MPF %d", i), thumb, err)
+		}
+	}
+
+	return checks, nil
+}
@@ -0,0 +1,116 @@
+package gainmap
+
+import (
+	"errors"
+	"io"
+
+	"github.com/ysh86/lspic/container"
+	"github.com/ysh86/lspic/jpeg"
+	"github.com/ysh86/lspic/xmp"
+)
+
+// GainMap is the gain map image embedded in the JPEG file.
+type GainMap struct {
+	Metadata *Metadata
+
+	// position of the gain map JPEG in the file
+	Offset int64
+	Length int64
+
+	Image *io.SectionReader
+}
+
+// Find finds the gain map of the file (Ultra HDR, ISO 21496-1).
+// It returns nil if the file has no gain map.
+//
+// The gain map is a secondary JPEG referred by MPF, or by the
+// Container:Directory item with Item:Semantic="GainMap". Its metadata is
+// the ISO 21496-1 APP2 or the hdrgm XMP of the gain map JPEG, the former
+// is preferred.
+func Find(f *jpeg.File) (*GainMap, error) {
+	type candidate struct {
+		offset, length int64
+	}
+	var candidates []candidate
+
+	if f.MPF() != nil {
+		images, err := f.MPImages()
+		if err != nil {
+			return nil, err
+		}
+		for _, img := range images {
+			if img.FileOffset != 0 && img.IsJPEG() {
+				candidates = append(candidates, candidate{img.FileOffset, img.Size})
+			}
+		}
+	} else {
+		p, err := packet(f)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			d, err := container.Parse(f, p)
+			if err != nil {
+				return nil, err
+			}
+			if d != nil {
+				if item := d.Find(container.SemanticGainMap); item != nil {
+					candidates = append(candidates, candidate{item.Offset, item.Length})
+				}
+			}
+		}
+	}
+
+	for _, c := range candidates {
+		sr := f.Section(c.offset, c.length)
+		sub, err := jpeg.NewFile(sr)
+		if err != nil {
+			return nil, err
+		}
+		if err := sub.Parse(); err != nil {
+			return nil, err
+		}
+
+		m, err := metadata(sub)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			return &GainMap{
+				Metadata: m,
+				Offset:   c.offset,
+				Length:   c.length,
+				Image:    sr,
+			}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func metadata(f *jpeg.File) (*Metadata, error) {
+	if b := f.GainMapMetadata(); b != nil {
+		m, err := ParseISO(b)
+		if err != nil || m != nil {
+			return m, err
+		}
+	}
+
+	p, err := packet(f)
+	if err != nil || p == nil {
+		return nil, err
+	}
+	return ParseXMP(p)
+}
+
+func packet(f *jpeg.File) (*xmp.Packet, error) {
+	x, err := f.XMP()
+	if err != nil || x == nil {
+		return nil, err
+	}
+	p, err := xmp.Parse(x.Bytes())
+	if err != nil {
+		return nil, errors.New("invalid XMP: " + err.Error())
+	}
+	return p, nil
+}
@@ -0,0 +1,133 @@
+package gainmap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	stdjpeg "image/jpeg"
+	"io"
+	"math"
+)
+
+// HDR is the reconstructed HDR image in linear RGB, where 1.0 is the
+// SDR white.
+type HDR struct {
+	Width  int
+	Height int
+	Pix    []float32 // RGB
+}
+
+// Decode decodes the gain map image.
+func (g *GainMap) Decode() (image.Image, error) {
+	if _, err := g.Image.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return stdjpeg.Decode(g.Image)
+}
+
+// HDR reconstructs the HDR image from the base (primary) image for the
+// display of the boost, the linear ratio of the HDR white to the SDR
+// white.
+func (g *GainMap) HDR(base image.Image, boost float64) (*HDR, error) {
+	gm, err := g.Decode()
+	if err != nil {
+		return nil, err
+	}
+	return g.Metadata.Apply(base, gm, boost), nil
+}
+
+// Apply applies the gain map to the base image:
+//
+//	G = GainMapMin*(1-g) + GainMapMax*g, g = gain^(1/Gamma)
+//	alternate = (base + OffsetBase) * 2^(G*W) - OffsetAlternate
+//
+// where W is the weight for the boost. The base image is assumed to be
+// encoded with the sRGB transfer function, and the gain map is scaled
+// bilinearly to the base image.
+func (m *Metadata) Apply(base, gainMap image.Image, boost float64) *HDR {
+	b := base.Bounds()
+	gb := gainMap.Bounds()
+	h := &HDR{
+		Width:  b.Dx(),
+		Height: b.Dy(),
+		Pix:    make([]float32, b.Dx()*b.Dy()*3),
+	}
+
+	w := m.Weight(boost)
+	offsetBase, offsetAlternate := m.OffsetSDR, m.OffsetHDR
+	if m.BaseRenditionIsHDR {
+		offsetBase, offsetAlternate = m.OffsetHDR, m.OffsetSDR
+	}
+
+	gain := func(x, y int) [3]float64 {
+		c := color.RGBA64Model.Convert(gainMap.At(gb.Min.X+x, gb.Min.Y+y)).(color.RGBA64)
+		return [3]float64{float64(c.R) / 0xffff, float64(c.G) / 0xffff, float64(c.B) / 0xffff}
+	}
+
+	i := 0
+	for y := 0; y < h.Height; y++ {
+		// bilinear sampling of the gain map
+		gy := (float64(y)+0.5)*float64(gb.Dy())/float64(h.Height) - 0.5
+		y0 := int(math.Floor(gy))
+		fy := gy - float64(y0)
+		y0, y1 := clamp(y0, gb.Dy()), clamp(y0+1, gb.Dy())
+
+		for x := 0; x < h.Width; x++ {
+			gx := (float64(x)+0.5)*float64(gb.Dx())/float64(h.Width) - 0.5
+			x0 := int(math.Floor(gx))
+			fx := gx - float64(x0)
+			x0, x1 := clamp(x0, gb.Dx()), clamp(x0+1, gb.Dx())
+
+			g00, g10, g01, g11 := gain(x0, y0), gain(x1, y0), gain(x0, y1), gain(x1, y1)
+			c := color.RGBA64Model.Convert(base.At(b.Min.X+x, b.Min.Y+y)).(color.RGBA64)
+			rgb := [3]uint16{c.R, c.G, c.B}
+
+			for ch := 0; ch < 3; ch++ {
+				gv := (g00[ch]*(1-fx)+g10[ch]*fx)*(1-fy) + (g01[ch]*(1-fx)+g11[ch]*fx)*fy
+				gv = math.Pow(gv, 1/m.Gamma[ch])
+				logBoost := m.GainMapMin[ch]*(1-gv) + m.GainMapMax[ch]*gv
+
+				v := (srgbToLinear(float64(rgb[ch])/0xffff)+offsetBase[ch])*math.Exp2(logBoost*w) - offsetAlternate[ch]
+				h.Pix[i] = float32(math.Max(v, 0))
+				i++
+			}
+		}
+	}
+
+	return h
+}
+
+func clamp(v, n int) int {
+	if v < 0 {
+		return 0
+	}
+	if v >= n {
+		return n - 1
+	}
+	return v
+}
+
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// WritePFM writes the image in the PFM (Portable Float Map) format.
+func (h *HDR) WritePFM(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	// negative scale: little-endian
+	fmt.Fprintf(bw, "PF\n%d %d\n-1.0\n", h.Width, h.Height)
+
+	// bottom to top
+	stride := h.Width * 3
+	for y := h.Height - 1; y >= 0; y-- {
+		if err := binary.Write(bw, binary.LittleEndian, h.Pix[y*stride:(y+1)*stride]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,258 @@
+package gainmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/ysh86/lspic/xmp"
+)
+
+// Metadata is the gain map metadata. The values are per channel (RGB),
+// and GainMapMin, GainMapMax and HDRCapacityMin/Max are in log2 space.
+type Metadata struct {
+	// hdrgm:Version, or the writer version of ISO 21496-1
+	Version string
+
+	GainMapMin [3]float64
+	GainMapMax [3]float64
+	Gamma      [3]float64
+	OffsetSDR  [3]float64
+	OffsetHDR  [3]float64
+
+	HDRCapacityMin float64
+	HDRCapacityMax float64
+
+	BaseRenditionIsHDR bool
+
+	// ISO 21496-1 only
+	UseBaseColorSpace bool
+}
+
+// String makes Metadata satisfy the Stringer interface.
+func (m *Metadata) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("  version: %s\n", m.Version))
+	buf.WriteString(fmt.Sprintf("  gain map min: %v\n", m.GainMapMin))
+	buf.WriteString(fmt.Sprintf("  gain map max: %v\n", m.GainMapMax))
+	buf.WriteString(fmt.Sprintf("  gamma: %v\n", m.Gamma))
+	buf.WriteString(fmt.Sprintf("  offset SDR: %v\n", m.OffsetSDR))
+	buf.WriteString(fmt.Sprintf("  offset HDR: %v\n", m.OffsetHDR))
+	buf.WriteString(fmt.Sprintf("  HDR capacity: %v - %v\n", m.HDRCapacityMin, m.HDRCapacityMax))
+	buf.WriteString(fmt.Sprintf("  base rendition is HDR: %v\n", m.BaseRenditionIsHDR))
+	return buf.String()
+}
+
+// ParseXMP parses the hdrgm metadata in p. It returns nil if p has no
+// hdrgm:Version.
+func ParseXMP(p *xmp.Packet) (*Metadata, error) {
+	version := p.Property(xmp.NsHDRGM, "Version")
+	if version == nil {
+		return nil, nil
+	}
+	m := &Metadata{Version: version.Value}
+
+	// single value for all channels or Seq of RGB
+	channels := func(name string, def float64, required bool) ([3]float64, error) {
+		var v [3]float64
+		prop := p.Property(xmp.NsHDRGM, name)
+		if prop == nil {
+			if required {
+				return v, fmt.Errorf("no hdrgm:%s", name)
+			}
+			return [3]float64{def, def, def}, nil
+		}
+		values := []string{prop.Value}
+		if prop.IsArray() {
+			values = values[:0]
+			for _, item := range prop.Items {
+				values = append(values, item.Value)
+			}
+		}
+		if len(values) != 1 && len(values) != 3 {
+			return v, fmt.Errorf("invalid hdrgm:%s: %d values", name, len(values))
+		}
+		for i := range v {
+			f, err := strconv.ParseFloat(values[i%len(values)], 64)
+			if err != nil {
+				return v, fmt.Errorf("invalid hdrgm:%s: %q", name, values[i%len(values)])
+			}
+			v[i] = f
+		}
+		return v, nil
+	}
+	single := func(name string, def float64, required bool) (float64, error) {
+		v, err := channels(name, def, required)
+		return v[0], err
+	}
+
+	var err error
+	if m.GainMapMin, err = channels("GainMapMin", 0, false); err != nil {
+		return nil, err
+	}
+	if m.GainMapMax, err = channels("GainMapMax", 0, true); err != nil {
+		return nil, err
+	}
+	if m.Gamma, err = channels("Gamma", 1, false); err != nil {
+		return nil, err
+	}
+	if m.OffsetSDR, err = channels("OffsetSDR", 1.0/64, false); err != nil {
+		return nil, err
+	}
+	if m.OffsetHDR, err = channels("OffsetHDR", 1.0/64, false); err != nil {
+		return nil, err
+	}
+	if m.HDRCapacityMin, err = single("HDRCapacityMin", 0, false); err != nil {
+		return nil, err
+	}
+	if m.HDRCapacityMax, err = single("HDRCapacityMax", 0, true); err != nil {
+		return nil, err
+	}
+	if prop := p.Property(xmp.NsHDRGM, "BaseRenditionIsHDR"); prop != nil {
+		m.BaseRenditionIsHDR = prop.Value == "True"
+	}
+
+	return m, m.validate()
+}
+
+// ISO 21496-1 flags
+const (
+	isoMultiChannel       = 1 << 7
+	isoUseBaseColorSpace  = 1 << 6
+	isoUseCommonDenom     = 1 << 3
+	isoBackwardDirection  = 1 << 2
+	isoMinimumVersionSize = 4
+)
+
+// ParseISO parses the ISO 21496-1 binary metadata in APP2 (without the
+// identifier). It returns nil if b has only the version, as in the
+// primary image.
+func ParseISO(b []byte) (*Metadata, error) {
+	r := bytes.NewReader(b)
+	var version struct {
+		Minimum uint16
+		Writer  uint16
+	}
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return nil, errors.New("short ISO 21496-1 metadata")
+	}
+	if version.Minimum != 0 {
+		return nil, fmt.Errorf("unsupported ISO 21496-1 version: %d", version.Minimum)
+	}
+	if len(b) == isoMinimumVersionSize {
+		return nil, nil
+	}
+
+	var flags uint8
+	if err := binary.Read(r, binary.BigEndian, &flags); err != nil {
+		return nil, err
+	}
+	m := &Metadata{
+		Version:            strconv.Itoa(int(version.Writer)),
+		BaseRenditionIsHDR: flags&isoBackwardDirection != 0,
+		UseBaseColorSpace:  flags&isoUseBaseColorSpace != 0,
+	}
+	channels := 1
+	if flags&isoMultiChannel != 0 {
+		channels = 3
+	}
+
+	var err error
+	var common uint32
+	commonDenom := flags&isoUseCommonDenom != 0
+	if commonDenom {
+		if err := binary.Read(r, binary.BigEndian, &common); err != nil {
+			return nil, err
+		}
+		if common == 0 {
+			return nil, errors.New("zero denominator")
+		}
+	}
+	fraction := func(signed bool) float64 {
+		if err != nil {
+			return 0
+		}
+		var n, d uint32
+		if err = binary.Read(r, binary.BigEndian, &n); err != nil {
+			return 0
+		}
+		if commonDenom {
+			d = common
+		} else if err = binary.Read(r, binary.BigEndian, &d); err != nil {
+			return 0
+		}
+		if d == 0 {
+			err = errors.New("zero denominator")
+			return 0
+		}
+		if signed {
+			return float64(int32(n)) / float64(d)
+		}
+		return float64(n) / float64(d)
+	}
+
+	baseHeadroom := fraction(false)
+	alternateHeadroom := fraction(false)
+	var baseOffset, alternateOffset [3]float64
+	for c := 0; c < channels; c++ {
+		m.GainMapMin[c] = fraction(true)
+		m.GainMapMax[c] = fraction(true)
+		m.Gamma[c] = fraction(false)
+		baseOffset[c] = fraction(true)
+		alternateOffset[c] = fraction(true)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("short ISO 21496-1 metadata: %w", err)
+	}
+	for c := channels; c < 3; c++ {
+		m.GainMapMin[c] = m.GainMapMin[0]
+		m.GainMapMax[c] = m.GainMapMax[0]
+		m.Gamma[c] = m.Gamma[0]
+		baseOffset[c] = baseOffset[0]
+		alternateOffset[c] = alternateOffset[0]
+	}
+
+	if m.BaseRenditionIsHDR {
+		m.HDRCapacityMin, m.HDRCapacityMax = alternateHeadroom, baseHeadroom
+		m.OffsetSDR, m.OffsetHDR = alternateOffset, baseOffset
+	} else {
+		m.HDRCapacityMin, m.HDRCapacityMax = baseHeadroom, alternateHeadroom
+		m.OffsetSDR, m.OffsetHDR = baseOffset, alternateOffset
+	}
+
+	return m, m.validate()
+}
+
+func (m *Metadata) validate() error {
+	for c := 0; c < 3; c++ {
+		if m.GainMapMax[c] < m.GainMapMin[c] {
+			return fmt.Errorf("gain map max < min: %v < %v", m.GainMapMax[c], m.GainMapMin[c])
+		}
+		if m.Gamma[c] <= 0 {
+			return fmt.Errorf("invalid gamma: %v", m.Gamma[c])
+		}
+	}
+	if m.HDRCapacityMax < m.HDRCapacityMin || m.HDRCapacityMin < 0 {
+		return fmt.Errorf("invalid HDR capacity: %v - %v", m.HDRCapacityMin, m.HDRCapacityMax)
+	}
+	return nil
+}
+
+// Weight returns the weight of the gain map applied for the display of
+// the boost (the linear ratio of the HDR white to the SDR white).
+func (m *Metadata) Weight(boost float64) float64 {
+	var w float64
+	if m.HDRCapacityMax > m.HDRCapacityMin {
+		w = (math.Log2(math.Max(boost, 1)) - m.HDRCapacityMin) / (m.HDRCapacityMax - m.HDRCapacityMin)
+	} else if math.Log2(math.Max(boost, 1)) >= m.HDRCapacityMax {
+		w = 1
+	}
+	w = math.Max(0, math.Min(1, w))
+	if m.BaseRenditionIsHDR {
+		w = 1 - w
+	}
+	return w
+}
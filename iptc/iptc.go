@@ -0,0 +1,193 @@
+package iptc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// Record number
+const (
+	EnvelopeRecord    uint8 = 1
+	ApplicationRecord uint8 = 2
+)
+
+// DataSet is an IPTC-IIM dataset.
+type DataSet struct {
+	Record  uint8
+	DataSet uint8
+	Data    []byte
+}
+
+// Name returns the name of the dataset.
+func (d *DataSet) Name() string {
+	name, ok := dataSetName[[2]uint8{d.Record, d.DataSet}]
+	if !ok {
+		name = fmt.Sprintf("%d:%d", d.Record, d.DataSet)
+	}
+	return name
+}
+
+// IsBinary returns that the data of the dataset is binary or not.
+func (d *DataSet) IsBinary() bool {
+	return binaryDataSet[[2]uint8{d.Record, d.DataSet}]
+}
+
+// Data is the IPTC-IIM data of the resource 0x0404.
+type Data struct {
+	DataSets []*DataSet
+
+	utf8 bool
+}
+
+// Parse parses the IPTC-IIM datasets.
+func Parse(b []byte) (*Data, error) {
+	d := &Data{}
+
+	for len(b) > 0 {
+		if b[0] != 0x1c {
+			// padding
+			if bytes.Count(b, []byte{0}) == len(b) {
+				break
+			}
+			return nil, fmt.Errorf("invalid tag marker: %02x", b[0])
+		}
+		if len(b) < 5 {
+			return nil, errors.New("short dataset")
+		}
+
+		ds := &DataSet{Record: b[1], DataSet: b[2]}
+		length := int(binary.BigEndian.Uint16(b[3:]))
+		b = b[5:]
+		if length&0x8000 != 0 {
+			// extended dataset
+			n := length & 0x7fff
+			if n > 4 || len(b) < n {
+				return nil, errors.New("invalid extended dataset")
+			}
+			length = 0
+			for _, v := range b[:n] {
+				length = length<<8 | int(v)
+			}
+			b = b[n:]
+		}
+		if len(b) < length {
+			return nil, fmt.Errorf("short data of dataset %d:%d", ds.Record, ds.DataSet)
+		}
+		ds.Data = b[:length]
+		b = b[length:]
+
+		d.DataSets = append(d.DataSets, ds)
+	}
+
+	// CodedCharacterSet 1:90
+	if cs := d.Get(EnvelopeRecord, 90); cs != nil {
+		d.utf8 = bytes.Equal(cs.Data, []byte{0x1b, '%', 'G'})
+	}
+
+	return d, nil
+}
+
+// Get returns the first dataset of record:dataset.
+func (d *Data) Get(record, dataset uint8) *DataSet {
+	for _, ds := range d.DataSets {
+		if ds.Record == record && ds.DataSet == dataset {
+			return ds
+		}
+	}
+	return nil
+}
+
+// All returns the datasets of record:dataset (repeatable datasets).
+func (d *Data) All(record, dataset uint8) []*DataSet {
+	var all []*DataSet
+	for _, ds := range d.DataSets {
+		if ds.Record == record && ds.DataSet == dataset {
+			all = append(all, ds)
+		}
+	}
+	return all
+}
+
+// UTF8 returns that CodedCharacterSet declares UTF-8 or not.
+func (d *Data) UTF8() bool {
+	return d.utf8
+}
+
+// Text decodes the data of the dataset to a string.
+// Without CodedCharacterSet, valid UTF-8 is taken as is and
+// the others are decoded as ISO 8859-1.
+func (d *Data) Text(ds *DataSet) string {
+	if d.utf8 || utf8.Valid(ds.Data) {
+		return string(ds.Data)
+	}
+	r := make([]rune, len(ds.Data))
+	for i, b := range ds.Data {
+		r[i] = rune(b)
+	}
+	return string(r)
+}
+
+// String makes Data satisfy the Stringer interface.
+func (d *Data) String() string {
+	var buf bytes.Buffer
+	for _, ds := range d.DataSets {
+		if ds.IsBinary() {
+			buf.WriteString(fmt.Sprintf("    %d:%03d %s: % x\n", ds.Record, ds.DataSet, ds.Name(), ds.Data))
+		} else {
+			buf.WriteString(fmt.Sprintf("    %d:%03d %s: %s\n", ds.Record, ds.DataSet, ds.Name(), d.Text(ds)))
+		}
+	}
+	return buf.String()
+}
+
+// Set replaces the datasets of record:dataset with the values.
+// The new datasets are placed at the position of the first old one, or
+// appended if there is none.
+func (d *Data) Set(record, dataset uint8, values ...[]byte) {
+	var sets []*DataSet
+	for _, v := range values {
+		sets = append(sets, &DataSet{Record: record, DataSet: dataset, Data: v})
+	}
+
+	var dataSets []*DataSet
+	for _, ds := range d.DataSets {
+		if ds.Record == record && ds.DataSet == dataset {
+			dataSets = append(dataSets, sets...)
+			sets = nil
+			continue
+		}
+		dataSets = append(dataSets, ds)
+	}
+	d.DataSets = append(dataSets, sets...)
+
+	if record == EnvelopeRecord && dataset == 90 {
+		d.utf8 = len(values) > 0 && bytes.Equal(values[0], []byte{0x1b, '%', 'G'})
+	}
+}
+
+// Marshal encodes the datasets in the order of the records.
+// The data over 32767 bytes is encoded as the extended dataset.
+func (d *Data) Marshal() []byte {
+	dataSets := make([]*DataSet, len(d.DataSets))
+	copy(dataSets, d.DataSets)
+	sort.SliceStable(dataSets, func(i, j int) bool {
+		return dataSets[i].Record < dataSets[j].Record
+	})
+
+	var b []byte
+	for _, ds := range dataSets {
+		b = append(b, 0x1c, ds.Record, ds.DataSet)
+		if len(ds.Data) < 0x8000 {
+			b = binary.BigEndian.AppendUint16(b, uint16(len(ds.Data)))
+		} else {
+			b = binary.BigEndian.AppendUint16(b, 0x8000|4)
+			b = binary.BigEndian.AppendUint32(b, uint32(len(ds.Data)))
+		}
+		b = append(b, ds.Data...)
+	}
+	return b
+}
@@ -0,0 +1,136 @@
+package jpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const jumbfIdentifier = "JP"
+
+// APP11Data is the Application Segment 11 (JPEG universal metadata box
+// format, JUMBF)
+type APP11Data struct {
+	SegmentData
+
+	identifier string
+
+	// box instance number and packet sequence number
+	Instance uint16
+	Sequence uint32
+
+	// box header and a part of the payload of the JUMBF box
+	box []byte
+	err error
+}
+
+// Parse parses APP11 data. The malformed segment is kept unparsed with the
+// error not to make the image unreadable.
+func (d *APP11Data) Parse(segment *Segment) error {
+	d.err = d.parse(segment.reader)
+	return nil
+}
+
+func (d *APP11Data) parse(r io.Reader) error {
+	var ident [2]byte
+	if _, err := io.ReadFull(r, ident[:]); err != nil {
+		return err
+	}
+	d.identifier = string(ident[:])
+	if d.identifier != jumbfIdentifier {
+		// not supported
+		return nil
+	}
+
+	if err := binary.Read(r, binary.BigEndian, &d.Instance); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.BigEndian, &d.Sequence); err != nil {
+		return err
+	}
+
+	box, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(box) < 8 || (binary.BigEndian.Uint32(box) == 1 && len(box) < 16) {
+		return errors.New("invalid JUMBF box")
+	}
+	d.box = box
+
+	return nil
+}
+
+// boxType returns the type of the JUMBF box.
+func (d *APP11Data) boxType() string {
+	return string(d.box[4:8])
+}
+
+// headerSize returns the size of the box header repeated in the segments.
+func (d *APP11Data) headerSize() int {
+	if binary.BigEndian.Uint32(d.box) == 1 {
+		// XLBox
+		return 16
+	}
+	return 8
+}
+
+// String makes APP11Data satisfy the Stringer interface.
+func (d *APP11Data) String() string {
+	var buf bytes.Buffer
+
+	buf.WriteString(fmt.Sprintf("  identifier: %s\n", d.identifier))
+	if d.err != nil {
+		buf.WriteString(fmt.Sprintf("  invalid: %v\n", d.err))
+	} else if d.identifier == jumbfIdentifier {
+		buf.WriteString(fmt.Sprintf("  instance: %d, sequence: %d\n", d.Instance, d.Sequence))
+		buf.WriteString(fmt.Sprintf("  box: '%s', %d[bytes]\n", d.boxType(), len(d.box)))
+	}
+
+	return buf.String()
+}
+
+// JUMBF returns the JUMBF boxes of the file in the order of appearance.
+// The box split across APP11 segments is reassembled from the segments of
+// the same instance number in the order of the sequence numbers, and the
+// box header repeated in the continued segments is removed.
+func (f *File) JUMBF() ([][]byte, error) {
+	var order []uint16
+	chunks := make(map[uint16][]*APP11Data)
+	for _, seg := range f.Segments {
+		if app11, ok := seg.parsedData.(*APP11Data); ok && app11.identifier == jumbfIdentifier && app11.err == nil {
+			if chunks[app11.Instance] == nil {
+				order = append(order, app11.Instance)
+			}
+			chunks[app11.Instance] = append(chunks[app11.Instance], app11)
+		}
+	}
+
+	var boxes [][]byte
+	for _, en := range order {
+		ordered := make([]*APP11Data, len(chunks[en]))
+		for _, chunk := range chunks[en] {
+			z := int(chunk.Sequence)
+			if z < 1 || z > len(ordered) || ordered[z-1] != nil {
+				return nil, fmt.Errorf("invalid sequence of JUMBF box %d", en)
+			}
+			ordered[z-1] = chunk
+		}
+
+		var box []byte
+		for i, chunk := range ordered {
+			if i == 0 {
+				box = append(box, chunk.box...)
+				continue
+			}
+			if chunk.boxType() != ordered[0].boxType() {
+				return nil, fmt.Errorf("type mismatch of JUMBF box %d", en)
+			}
+			box = append(box, chunk.box[chunk.headerSize():]...)
+		}
+		boxes = append(boxes, box)
+	}
+	return boxes, nil
+}
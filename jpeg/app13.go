@@ -0,0 +1,187 @@
+package jpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ysh86/lspic/iptc"
+)
+
+// Photoshop Image Resource ID
+const (
+	ResourceIPTCNAA uint16 = 0x0404
+)
+
+const photoshopIdentifier = "Photoshop 3.0"
+
+// PhotoshopResource is an Image Resource Block (8BIM).
+type PhotoshopResource struct {
+	Signature string
+	ID        uint16
+	Name      string
+	Data      []byte
+}
+
+// APP13Data is the Application Segment 13 (Photoshop IRB)
+type APP13Data struct {
+	SegmentData
+
+	identifier string
+
+	payload   []byte
+	resources []*PhotoshopResource
+	err       error
+}
+
+// Parse parses APP13 data.
+func (d *APP13Data) Parse(segment *Segment) error {
+	sr := segment.reader
+
+	ident := make([]byte, 0, 16)
+	for {
+		var b byte
+		err := binary.Read(sr, binary.BigEndian, &b)
+		if err != nil || b == 0 {
+			break
+		}
+		ident = append(ident, b)
+	}
+	d.identifier = string(ident)
+	if d.identifier != photoshopIdentifier {
+		// not supported
+		return nil
+	}
+
+	payload, err := io.ReadAll(sr)
+	if err != nil {
+		return err
+	}
+	d.payload = payload
+
+	// The resources may continue to the next APP13.
+	d.resources, d.err = parsePhotoshopResources(payload)
+
+	return nil
+}
+
+// String makes APP13Data satisfy the Stringer interface.
+func (d *APP13Data) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("  identifier: %s\n", d.identifier))
+
+	for _, r := range d.resources {
+		buf.WriteString(fmt.Sprintf("  %s %04x \"%s\": %d[bytes]\n", r.Signature, r.ID, r.Name, len(r.Data)))
+		if r.ID == ResourceIPTCNAA {
+			data, err := iptc.Parse(r.Data)
+			if err != nil {
+				buf.WriteString(fmt.Sprintf("    IPTC: %v\n", err))
+			} else {
+				buf.WriteString(data.String())
+			}
+		}
+	}
+	if d.err != nil {
+		buf.WriteString(fmt.Sprintf("  incomplete: %v\n", d.err))
+	}
+
+	return buf.String()
+}
+
+func parsePhotoshopResources(b []byte) ([]*PhotoshopResource, error) {
+	var resources []*PhotoshopResource
+	for len(b) > 0 {
+		if len(b) < 4+2+1 {
+			if bytes.Count(b, []byte{0}) == len(b) {
+				// padding
+				break
+			}
+			return resources, errors.New("short resource block")
+		}
+
+		r := &PhotoshopResource{Signature: string(b[0:4])}
+		switch r.Signature {
+		case "8BIM", "PHUT", "DCSR", "AgHg", "MeSa":
+		default:
+			return resources, fmt.Errorf("invalid signature of resource block: %q", r.Signature)
+		}
+		r.ID = binary.BigEndian.Uint16(b[4:])
+		b = b[6:]
+
+		// Pascal string, padded to make the size even
+		nameLen := int(b[0])
+		padded := (1 + nameLen + 1) &^ 1
+		if len(b) < padded+4 {
+			return resources, errors.New("short resource block")
+		}
+		r.Name = string(b[1 : 1+nameLen])
+		b = b[padded:]
+
+		size := int(binary.BigEndian.Uint32(b))
+		b = b[4:]
+		if len(b) < size {
+			return resources, fmt.Errorf("short data of resource %04x", r.ID)
+		}
+		r.Data = b[:size]
+		b = b[size:]
+		if size%2 != 0 && len(b) > 0 {
+			b = b[1:]
+		}
+
+		resources = append(resources, r)
+	}
+	return resources, nil
+}
+
+func marshalPhotoshopResources(resources []*PhotoshopResource) []byte {
+	var b []byte
+	for _, r := range resources {
+		b = append(b, r.Signature...)
+		b = binary.BigEndian.AppendUint16(b, r.ID)
+
+		// Pascal string, padded to make the size even
+		b = append(b, uint8(len(r.Name)))
+		b = append(b, r.Name...)
+		if len(r.Name)%2 == 0 {
+			b = append(b, 0)
+		}
+
+		b = binary.BigEndian.AppendUint32(b, uint32(len(r.Data)))
+		b = append(b, r.Data...)
+		if len(r.Data)%2 != 0 {
+			b = append(b, 0)
+		}
+	}
+	return b
+}
+
+// PhotoshopResources returns the image resource blocks of the file.
+// The resources split across APP13 segments are concatenated.
+func (f *File) PhotoshopResources() ([]*PhotoshopResource, error) {
+	var payload []byte
+	for _, seg := range f.Segments {
+		if app13, ok := seg.parsedData.(*APP13Data); ok && app13.identifier == photoshopIdentifier {
+			payload = append(payload, app13.payload...)
+		}
+	}
+	if payload == nil {
+		return nil, nil
+	}
+	return parsePhotoshopResources(payload)
+}
+
+// IPTC returns the IPTC-IIM data of the file, or nil if the file has no IPTC.
+func (f *File) IPTC() (*iptc.Data, error) {
+	resources, err := f.PhotoshopResources()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range resources {
+		if r.ID == ResourceIPTCNAA {
+			return iptc.Parse(r.Data)
+		}
+	}
+	return nil, nil
+}
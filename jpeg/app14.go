@@ -0,0 +1,181 @@
+package jpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// APP14Data is the Application Segment 14 (Adobe)
+type APP14Data struct {
+	SegmentData
+
+	identifier string
+	Version    uint16
+	Flags0     uint16
+	Flags1     uint16
+	Transform  uint8
+
+	err error
+}
+
+// Parse parses APP14 data. The unknown or truncated segment is not
+// supported, and kept unparsed.
+func (d *APP14Data) Parse(segment *Segment) error {
+	d.err = d.parse(segment.reader)
+	return nil
+}
+
+func (d *APP14Data) parse(r io.Reader) error {
+	var ident [5]byte
+	if _, err := io.ReadFull(r, ident[:]); err != nil {
+		return err
+	}
+	d.identifier = string(ident[:])
+	if d.identifier != "Adobe" {
+		// not supported
+		return nil
+	}
+
+	var b [7]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return err
+	}
+	d.Version = binary.BigEndian.Uint16(b[0:])
+	d.Flags0 = binary.BigEndian.Uint16(b[2:])
+	d.Flags1 = binary.BigEndian.Uint16(b[4:])
+	d.Transform = b[6]
+
+	return nil
+}
+
+// String makes APP14Data satisfy the Stringer interface.
+func (d *APP14Data) String() string {
+	var buf bytes.Buffer
+
+	buf.WriteString(fmt.Sprintf("  identifier: %s\n", d.identifier))
+	if d.err != nil {
+		buf.WriteString(fmt.Sprintf("  invalid: %v\n", d.err))
+	} else if d.identifier == "Adobe" {
+		buf.WriteString(fmt.Sprintf("  version: %d\n", d.Version))
+		buf.WriteString(fmt.Sprintf("  flags: %04x %04x\n", d.Flags0, d.Flags1))
+		buf.WriteString(fmt.Sprintf("  transform: %d\n", d.Transform))
+	}
+
+	return buf.String()
+}
+
+// ColorModel is the color model of the JPEG data.
+type ColorModel int
+
+// ColorModel
+const (
+	ColorUnknown ColorModel = iota
+	ColorGray
+	ColorYCbCr
+	ColorRGB
+	ColorCMYK
+	ColorYCCK
+)
+
+var colorModelName = map[ColorModel]string{
+	ColorUnknown: "Unknown",
+	ColorGray:    "Grayscale",
+	ColorYCbCr:   "YCbCr",
+	ColorRGB:     "RGB",
+	ColorCMYK:    "CMYK",
+	ColorYCCK:    "YCCK",
+}
+
+// String makes ColorModel satisfy the Stringer interface.
+func (c ColorModel) String() string {
+	name, ok := colorModelName[c]
+	if !ok {
+		name = strconv.Itoa(int(c))
+	}
+	return name
+}
+
+// Frame returns the SOF data and its marker. The invalid SOF is not
+// returned.
+func (f *File) Frame() (*SOFData, uint16) {
+	for _, seg := range f.Segments {
+		if sof, ok := seg.parsedData.(*SOFData); ok && sof.err == nil {
+			return sof, seg.Marker
+		}
+	}
+	return nil, Unknown
+}
+
+// Adobe returns the APP14 Adobe data, or nil if the file has no APP14.
+func (f *File) Adobe() *APP14Data {
+	for _, seg := range f.Segments {
+		if app14, ok := seg.parsedData.(*APP14Data); ok && app14.identifier == "Adobe" && app14.err == nil {
+			return app14
+		}
+	}
+	return nil
+}
+
+// ColorModel returns the effective color model of the file,
+// decided in the same way as libjpeg: the JFIF APP0, the transform flag
+// of the Adobe APP14, and the component IDs of SOF.
+func (f *File) ColorModel() (ColorModel, error) {
+	sof, _ := f.Frame()
+	if sof == nil {
+		return ColorUnknown, errors.New("no SOF")
+	}
+
+	jfif := false
+	for _, seg := range f.Segments {
+		if app0, ok := seg.parsedData.(*APP0Data); ok && app0.identifier == "JFIF" {
+			jfif = true
+			break
+		}
+	}
+	adobe := f.Adobe()
+
+	switch len(sof.Components) {
+	case 1:
+		return ColorGray, nil
+	case 3:
+		if jfif {
+			return ColorYCbCr, nil
+		}
+		if adobe != nil {
+			switch adobe.Transform {
+			case 0:
+				return ColorRGB, nil
+			case 1:
+				return ColorYCbCr, nil
+			default:
+				// unknown transform: assume YCbCr
+				return ColorYCbCr, nil
+			}
+		}
+		c := sof.Components
+		if c[0].ID == 'R' && c[1].ID == 'G' && c[2].ID == 'B' {
+			return ColorRGB, nil
+		}
+		// IDs 1, 2, 3 or unknown: assume YCbCr
+		return ColorYCbCr, nil
+	case 4:
+		if adobe != nil {
+			switch adobe.Transform {
+			case 0:
+				return ColorCMYK, nil
+			case 2:
+				return ColorYCCK, nil
+			default:
+				// unknown transform: assume YCCK
+				return ColorYCCK, nil
+			}
+		}
+		return ColorCMYK, nil
+	}
+
+	return ColorUnknown, fmt.Errorf("unsupported number of components: %d", len(sof.Components))
+}
@@ -0,0 +1,597 @@
+package jpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Block is the quantized DCT coefficients of a data unit (8x8 samples) in
+// the natural order, i.e. Block[v*8+u] for the horizontal frequency u and
+// the vertical frequency v.
+type Block [64]int16
+
+// Plane is the coefficients of a component.
+type Plane struct {
+	Component
+
+	// number of the blocks, padded to the MCUs
+	BlocksW int
+	BlocksH int
+	Blocks  []Block
+
+	// number of the blocks of the image without the padding
+	ImageBlocksW int
+	ImageBlocksH int
+}
+
+// Block returns the block at (bx, by) in blocks.
+func (p *Plane) Block(bx, by int) *Block {
+	return &p.Blocks[by*p.BlocksW+bx]
+}
+
+// Coefficients is the quantized DCT coefficients of the image.
+type Coefficients struct {
+	Marker    uint16 // SOF
+	Precision uint8
+	Width     int
+	Height    int
+
+	Planes []*Plane
+	hmax   int
+	vmax   int
+
+	// quantization tables in the natural order
+	Quant        [4][64]uint16
+	quantDefined [4]bool
+
+	// in MCUs, 0 if no restart
+	RestartInterval int
+}
+
+func (c *Coefficients) mcusX() int {
+	return (c.Width + 8*c.hmax - 1) / (8 * c.hmax)
+}
+
+func (c *Coefficients) mcusY() int {
+	return (c.Height + 8*c.vmax - 1) / (8 * c.vmax)
+}
+
+// blocksW returns the number of the blocks of the component without
+// the padding to the MCUs.
+func (c *Coefficients) blocksW(comp *Plane) int {
+	w := (c.Width*int(comp.H) + c.hmax - 1) / c.hmax
+	return (w + 7) / 8
+}
+
+// blocksH returns the number of the blocks of the component without
+// the padding to the MCUs.
+func (c *Coefficients) blocksH(comp *Plane) int {
+	h := (c.Height*int(comp.V) + c.vmax - 1) / c.vmax
+	return (h + 7) / 8
+}
+
+// allocate allocates the blocks of the components for the frame.
+func (c *Coefficients) allocate() {
+	c.hmax, c.vmax = 1, 1
+	for _, comp := range c.Planes {
+		if int(comp.H) > c.hmax {
+			c.hmax = int(comp.H)
+		}
+		if int(comp.V) > c.vmax {
+			c.vmax = int(comp.V)
+		}
+	}
+	for _, comp := range c.Planes {
+		comp.BlocksW = c.mcusX() * int(comp.H)
+		comp.BlocksH = c.mcusY() * int(comp.V)
+		comp.Blocks = make([]Block, comp.BlocksW*comp.BlocksH)
+		comp.ImageBlocksW, comp.ImageBlocksH = c.blocksW(comp), c.blocksH(comp)
+	}
+}
+
+// forEachBlock calls fn for each block of the scan in the coding order.
+// restart is true for the first block after a restart interval.
+func (c *Coefficients) forEachBlock(comps []*Plane, fn func(i int, b *Block, restart bool) error) error {
+	n := 0
+	next := func() bool {
+		restart := c.RestartInterval > 0 && n > 0 && n%c.RestartInterval == 0
+		n++
+		return restart
+	}
+
+	if len(comps) == 1 {
+		// non-interleaved: a data unit per MCU
+		comp := comps[0]
+		bw, bh := c.blocksW(comp), c.blocksH(comp)
+		for by := 0; by < bh; by++ {
+			for bx := 0; bx < bw; bx++ {
+				if err := fn(0, comp.Block(bx, by), next()); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	for my := 0; my < c.mcusY(); my++ {
+		for mx := 0; mx < c.mcusX(); mx++ {
+			restart := next()
+			for i, comp := range comps {
+				for v := 0; v < int(comp.V); v++ {
+					for h := 0; h < int(comp.H); h++ {
+						bx, by := mx*int(comp.H)+h, my*int(comp.V)+v
+						if err := fn(i, comp.Block(bx, by), restart); err != nil {
+							return err
+						}
+						restart = false
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// scanHeader is the header of SOS.
+type scanHeader struct {
+	comps []*Plane
+	td    []uint8
+	ta    []uint8
+	ss    uint8
+	se    uint8
+	ah    uint8
+	al    uint8
+}
+
+func (c *Coefficients) parseSOS(b []byte) (*scanHeader, error) {
+	if len(b) < 1 || len(b) != 1+2*int(b[0])+3 || b[0] == 0 || b[0] > 4 {
+		return nil, errors.New("invalid SOS")
+	}
+	n := int(b[0])
+	s := &scanHeader{}
+	for i := 0; i < n; i++ {
+		id := b[1+2*i]
+		var comp *Plane
+		for _, fc := range c.Planes {
+			if fc.ID == id {
+				comp = fc
+			}
+		}
+		if comp == nil {
+			return nil, fmt.Errorf("unknown component in SOS: %d", id)
+		}
+		td, ta := b[2+2*i]>>4, b[2+2*i]&0x0f
+		if td > 3 || ta > 3 {
+			return nil, fmt.Errorf("invalid table selector in SOS: %02x", b[2+2*i])
+		}
+		s.comps = append(s.comps, comp)
+		s.td = append(s.td, td)
+		s.ta = append(s.ta, ta)
+	}
+	p := b[1+2*n:]
+	s.ss, s.se, s.ah, s.al = p[0], p[1], p[2]>>4, p[2]&0x0f
+	return s, nil
+}
+
+func (c *Coefficients) parseDQT(b []byte) error {
+	for len(b) > 0 {
+		pq, tq := b[0]>>4, b[0]&0x0f
+		if pq > 1 || tq > 3 {
+			return fmt.Errorf("invalid quantization table: %02x", b[0])
+		}
+		b = b[1:]
+		size := 64 * (1 + int(pq))
+		if len(b) < size {
+			return errors.New("short DQT")
+		}
+		for i := 0; i < 64; i++ {
+			if pq == 0 {
+				c.Quant[tq][zigzag[i]] = uint16(b[i])
+			} else {
+				c.Quant[tq][zigzag[i]] = binary.BigEndian.Uint16(b[2*i:])
+			}
+		}
+		c.quantDefined[tq] = true
+		b = b[size:]
+	}
+	return nil
+}
+
+func (c *Coefficients) parseDRI(b []byte) error {
+	if len(b) != 2 {
+		return errors.New("invalid DRI")
+	}
+	c.RestartInterval = int(binary.BigEndian.Uint16(b))
+	return nil
+}
+
+func (c *Coefficients) setFrame(marker uint16, sof *SOFData) error {
+	if len(sof.Components) == 0 || sof.Width == 0 || sof.Height == 0 {
+		return errors.New("invalid SOF")
+	}
+	c.Marker = marker
+	c.Precision = sof.Precision
+	c.Width, c.Height = int(sof.Width), int(sof.Height)
+	c.Planes = nil
+	for _, comp := range sof.Components {
+		if comp.H < 1 || comp.H > 4 || comp.V < 1 || comp.V > 4 || comp.Tq > 3 {
+			return fmt.Errorf("invalid component: %d", comp.ID)
+		}
+		c.Planes = append(c.Planes, &Plane{Component: comp})
+	}
+	c.allocate()
+	return nil
+}
+
+func readPayload(seg *Segment) ([]byte, error) {
+	b := make([]byte, seg.Length)
+	if _, err := seg.reader.ReadAt(b, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Coefficients decodes the entropy-coded data into the quantized DCT
+// coefficients without IDCT. The sequential and progressive Huffman coding
+// are supported. The height 0 of SOF is defined by DNL.
+func (f *File) Coefficients() (*Coefficients, error) {
+	c, _, err := f.decodeCoefficients(false)
+	return c, err
+}
+
+// scanInfo is the position of a scan in the entropy-coded data.
+type scanInfo struct {
+	// offset of SOS in the data, or -1 for the SOS segment before the data
+	start    int
+	complete bool
+}
+
+// decodeCoefficients decodes the coefficients and returns the scans. In the
+// salvage mode, the decoding stops at the block beyond the data of the
+// truncated or damaged scan, and the following blocks are left zero.
+func (f *File) decodeCoefficients(salvage bool) (*Coefficients, []*scanInfo, error) {
+	c := &Coefficients{}
+	var tables [2][4]*huffmanTable
+
+	// tables and scans
+	marker := func(m uint16, payload []byte) (*scanHeader, error) {
+		switch m {
+		case DQT:
+			return nil, c.parseDQT(payload)
+		case DHT:
+			return nil, parseDHT(payload, &tables)
+		case DRI:
+			return nil, c.parseDRI(payload)
+		case SOS:
+			if c.Planes == nil {
+				return nil, errors.New("no SOF before SOS")
+			}
+			return c.parseSOS(payload)
+		case SOF, SOF1, SOF2:
+			sof := &SOFData{}
+			seg := &Segment{Marker: m, Length: int64(len(payload)), reader: io.NewSectionReader(bytes.NewReader(payload), 0, int64(len(payload)))}
+			if err := sof.Parse(seg); err != nil {
+				return nil, err
+			}
+			if sof.err != nil {
+				return nil, sof.err
+			}
+			if dnl := f.DNL(); sof.Height == 0 && dnl != nil {
+				sof.Height = dnl.Lines
+			}
+			return nil, c.setFrame(m, sof)
+		case SOF3, SOF9, SOF10, SOF11:
+			return nil, fmt.Errorf("unsupported frame: %s", markerSegmentName[m])
+		}
+		return nil, nil
+	}
+
+	var scan *scanHeader
+	var scans []*scanInfo
+	for _, seg := range f.Segments {
+		switch {
+		case seg.Marker == SOI || seg.Marker == EOI || seg.Marker == Trailer || seg.Marker == COM || seg.IsAPPn():
+			continue
+		case seg.Marker != Data:
+			payload, err := readPayload(seg)
+			if err != nil {
+				return nil, nil, err
+			}
+			s, err := marker(seg.Marker, payload)
+			if err != nil {
+				return nil, nil, err
+			}
+			if s != nil {
+				scan = s
+			}
+			continue
+		}
+
+		// entropy-coded data and the marker segments between scans
+		data, err := readPayload(seg)
+		if err != nil {
+			return nil, nil, err
+		}
+		pos, start := 0, -1
+		for scan != nil {
+			n, complete, err := c.decodeScan(data[pos:], scan, &tables, salvage)
+			if err != nil {
+				return nil, nil, err
+			}
+			scans = append(scans, &scanInfo{start: start, complete: complete})
+			if !complete {
+				return c, scans, nil
+			}
+			pos += n
+			scan = nil
+
+			// next marker segment
+			for scan == nil && pos+4 <= len(data) {
+				if data[pos] != 0xff || data[pos+1] == 0xff || data[pos+1] == 0x00 || (0xd0 <= data[pos+1] && data[pos+1] <= 0xd7) {
+					pos++
+					continue
+				}
+				m := binary.BigEndian.Uint16(data[pos:])
+				length := int(binary.BigEndian.Uint16(data[pos+2:]))
+				if length < 2 || pos+2+length > len(data) {
+					return nil, nil, errors.New("invalid segment")
+				}
+				if scan, err = marker(m, data[pos+4:pos+2+length]); err != nil {
+					return nil, nil, err
+				}
+				start = pos
+				pos += 2 + length
+			}
+		}
+	}
+
+	if c.Planes == nil {
+		return nil, nil, errors.New("no SOF")
+	}
+	return c, scans, nil
+}
+
+// errTruncatedScan stops the decoding of the scan in the salvage mode.
+var errTruncatedScan = errors.New("truncated scan")
+
+// decodeScan decodes a scan and returns the length of the entropy-coded
+// data. complete is false if the scan is truncated or damaged in the
+// salvage mode.
+func (c *Coefficients) decodeScan(data []byte, s *scanHeader, tables *[2][4]*huffmanTable, salvage bool) (n int, complete bool, err error) {
+	d := &scanDecoder{r: &bitReader{data: data}, s: s, tables: tables, pred: make([]int32, len(s.comps))}
+
+	var decode func(i int, b *Block) error
+	switch {
+	case c.Marker != SOF2:
+		if s.ss != 0 || s.se != 63 || s.ah != 0 || s.al != 0 {
+			return 0, false, errors.New("invalid scan for the sequential mode")
+		}
+		decode = d.sequential
+	case s.se < s.ss || s.se > 63 || s.al > 13 || (s.ss == 0) != (s.se == 0) || (s.ss > 0 && len(s.comps) != 1):
+		return 0, false, errors.New("invalid scan for the progressive mode")
+	case s.ss == 0 && s.ah == 0:
+		decode = d.dcFirst
+	case s.ss == 0:
+		decode = d.dcRefine
+	case s.ah == 0:
+		decode = d.acFirst
+	default:
+		decode = d.acRefine
+	}
+
+	// Huffman tables selected by the scan
+	for i := range s.comps {
+		if s.ss == 0 && s.ah == 0 && tables[0][s.td[i]] == nil {
+			return 0, false, fmt.Errorf("undefined DC table: %d", s.td[i])
+		}
+		if (c.Marker != SOF2 || s.ss > 0) && tables[1][s.ta[i]] == nil {
+			return 0, false, fmt.Errorf("undefined AC table: %d", s.ta[i])
+		}
+	}
+
+	err = c.forEachBlock(s.comps, func(i int, b *Block, restart bool) error {
+		if restart {
+			if err := d.r.restart(); err != nil {
+				if salvage {
+					return errTruncatedScan
+				}
+				return err
+			}
+			for j := range d.pred {
+				d.pred[j] = 0
+			}
+			d.eobrun = 0
+		}
+		if err := decode(i, b); err != nil || (salvage && d.r.overrun()) {
+			if !salvage {
+				return err
+			}
+			*b = Block{}
+			return errTruncatedScan
+		}
+		return nil
+	})
+	if err == errTruncatedScan {
+		return d.r.pos, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	return d.r.pos, true, nil
+}
+
+// scanDecoder decodes the blocks of a scan (Annex F and G).
+type scanDecoder struct {
+	r      *bitReader
+	s      *scanHeader
+	tables *[2][4]*huffmanTable
+
+	pred   []int32
+	eobrun int32
+}
+
+func (d *scanDecoder) dc(i int) (int32, error) {
+	t, err := d.r.decode(d.tables[0][d.s.td[i]])
+	if err != nil {
+		return 0, err
+	}
+	d.pred[i] += d.r.receiveExtend(t)
+	return d.pred[i], nil
+}
+
+func (d *scanDecoder) sequential(i int, b *Block) error {
+	dc, err := d.dc(i)
+	if err != nil {
+		return err
+	}
+	b[0] = int16(dc)
+
+	ac := d.tables[1][d.s.ta[i]]
+	for k := 1; k < 64; k++ {
+		rs, err := d.r.decode(ac)
+		if err != nil {
+			return err
+		}
+		run, size := int(rs>>4), rs&0x0f
+		if size == 0 {
+			if run != 15 {
+				// EOB
+				break
+			}
+			k += 15
+			continue
+		}
+		k += run
+		if k > 63 {
+			return errors.New("invalid run length")
+		}
+		b[zigzag[k]] = int16(d.r.receiveExtend(size))
+	}
+	return nil
+}
+
+func (d *scanDecoder) dcFirst(i int, b *Block) error {
+	dc, err := d.dc(i)
+	if err != nil {
+		return err
+	}
+	b[0] = int16(dc << d.s.al)
+	return nil
+}
+
+func (d *scanDecoder) dcRefine(i int, b *Block) error {
+	if d.r.bits(1) != 0 {
+		b[0] |= 1 << d.s.al
+	}
+	return nil
+}
+
+// eob reads the length of EOBRUN of the run.
+func (d *scanDecoder) eob(run int) {
+	d.eobrun = 1 << run
+	if run > 0 {
+		d.eobrun += d.r.bits(uint(run))
+	}
+}
+
+func (d *scanDecoder) acFirst(i int, b *Block) error {
+	if d.eobrun > 0 {
+		d.eobrun--
+		return nil
+	}
+
+	ac := d.tables[1][d.s.ta[i]]
+	for k := int(d.s.ss); k <= int(d.s.se); k++ {
+		rs, err := d.r.decode(ac)
+		if err != nil {
+			return err
+		}
+		run, size := int(rs>>4), rs&0x0f
+		if size == 0 {
+			if run != 15 {
+				d.eob(run)
+				d.eobrun--
+				break
+			}
+			k += 15
+			continue
+		}
+		k += run
+		if k > int(d.s.se) {
+			return errors.New("invalid run length")
+		}
+		b[zigzag[k]] = int16(d.r.receiveExtend(size) << d.s.al)
+	}
+	return nil
+}
+
+func (d *scanDecoder) acRefine(i int, b *Block) error {
+	p1, m1 := int16(1)<<d.s.al, int16(-1)<<d.s.al
+	se := int(d.s.se)
+
+	// correction bit of the nonzero coefficient
+	refine := func(c *int16) {
+		if d.r.bits(1) != 0 && *c&p1 == 0 {
+			if *c >= 0 {
+				*c += p1
+			} else {
+				*c += m1
+			}
+		}
+	}
+
+	k := int(d.s.ss)
+	if d.eobrun == 0 {
+		ac := d.tables[1][d.s.ta[i]]
+		for ; k <= se; k++ {
+			rs, err := d.r.decode(ac)
+			if err != nil {
+				return err
+			}
+			run, size := int(rs>>4), rs&0x0f
+			var v int16
+			if size != 0 {
+				if size != 1 {
+					return errors.New("invalid refinement")
+				}
+				v = m1
+				if d.r.bits(1) != 0 {
+					v = p1
+				}
+			} else if run != 15 {
+				d.eob(run)
+				break
+			}
+
+			// skip the run of the zero coefficients refining the nonzero ones
+			for ; k <= se; k++ {
+				c := &b[zigzag[k]]
+				if *c != 0 {
+					refine(c)
+					continue
+				}
+				if run == 0 {
+					break
+				}
+				run--
+			}
+			if v != 0 && k <= se {
+				b[zigzag[k]] = v
+			}
+		}
+	}
+
+	if d.eobrun > 0 {
+		for ; k <= se; k++ {
+			if c := &b[zigzag[k]]; *c != 0 {
+				refine(c)
+			}
+		}
+		d.eobrun--
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package jpeg
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseSOS(t *testing.T) {
+	c := &Coefficients{Planes: []*Plane{{Component: Component{ID: 1}}, {Component: Component{ID: 2}}, {Component: Component{ID: 3}}}}
+	tests := []struct {
+		name    string
+		payload []byte
+		err     string
+	}{
+		{"valid", []byte{3, 1, 0x00, 2, 0x11, 3, 0x11, 0, 63, 0}, ""},
+		{"max selector", []byte{1, 1, 0x33, 0, 63, 0}, ""},
+		{"empty", []byte{}, "invalid SOS"},
+		{"no component", []byte{0, 0, 63, 0}, "invalid SOS"},
+		{"short", []byte{3, 1, 0x00, 2, 0x11, 0, 63, 0}, "invalid SOS"},
+		{"too many components", []byte{5, 1, 0, 2, 0, 3, 0, 1, 0, 2, 0, 0, 63, 0}, "invalid SOS"},
+		{"unknown component", []byte{1, 4, 0x00, 0, 63, 0}, "unknown component"},
+		{"invalid DC selector", []byte{1, 1, 0x40, 0, 63, 0}, "invalid table selector"},
+		{"invalid AC selector", []byte{1, 1, 0x04, 0, 63, 0}, "invalid table selector"},
+		{"invalid selectors", []byte{1, 1, 0x77, 0, 63, 0}, "invalid table selector"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.parseSOS(tt.payload)
+			checkError(t, err, tt.err)
+		})
+	}
+}
+
+func TestParseDHT(t *testing.T) {
+	// 2 codes of 1 bit
+	table := append([]byte{2}, make([]byte, 15)...)
+	tests := []struct {
+		name    string
+		payload []byte
+		err     string
+	}{
+		{"valid", append(append([]byte{0x13}, table...), 0, 1), ""},
+		{"two tables", append(append(append(append([]byte{0x00}, table...), 0, 1), append([]byte{0x10}, table...)...), 0, 1), ""},
+		{"invalid class", append(append([]byte{0x20}, table...), 0, 1), "invalid Huffman table"},
+		{"invalid id", append(append([]byte{0x04}, table...), 0, 1), "invalid Huffman table"},
+		{"short counts", []byte{0x00, 1, 0}, "short DHT"},
+		{"short symbols", append([]byte{0x00}, table...), "short DHT"},
+		// 3 codes of 1 bit
+		{"invalid counts", append(append([]byte{0x00, 3}, make([]byte, 15)...), 0, 1, 2), "invalid Huffman table"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tables [2][4]*huffmanTable
+			checkError(t, parseDHT(tt.payload, &tables), tt.err)
+		})
+	}
+}
+
+func TestUndefinedTable(t *testing.T) {
+	src := testJPEG(t, 16, 16)
+	// Y: DC 0, AC 0; Cb and Cr: DC 1, AC 1
+	sos := bytes.Index(src, []byte{0xff, 0xda, 0x00, 0x0c, 0x03, 0x01, 0x00, 0x02, 0x11, 0x03, 0x11})
+	if sos < 0 {
+		t.Fatal("SOS not found")
+	}
+	tests := []struct {
+		name     string
+		selector byte
+		err      string
+	}{
+		{"defined", 0x00, ""},
+		{"undefined DC", 0x20, "undefined DC table: 2"},
+		{"undefined AC", 0x03, "undefined AC table: 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := append([]byte(nil), src...)
+			b[sos+6] = tt.selector
+			_, err := parseJPEG(t, b).Coefficients()
+			checkError(t, err, tt.err)
+		})
+	}
+}
+
+func TestOptimalHuffmanTable(t *testing.T) {
+	// the frequencies of the powers of 2 make the deepest tree
+	pow2 := func(n int) [256]int {
+		var freq [256]int
+		for i := 0; i < n; i++ {
+			freq[i] = 1 << i
+		}
+		return freq
+	}
+	tests := []struct {
+		name string
+		freq [256]int
+		err  string
+	}{
+		{"no symbol", [256]int{}, ""},
+		{"one symbol", [256]int{5: 1}, ""},
+		{"uniform", func() (f [256]int) {
+			for i := range f {
+				f[i] = 1
+			}
+			return
+		}(), ""},
+		{"limited to 16 bits", pow2(30), ""},
+		{"overflow", pow2(40), "Huffman code size table overflow"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if strconv.IntSize < 64 && tt.freq[39] != 0 {
+				t.Skip("frequencies overflow int")
+			}
+			h, err := optimalHuffmanTable(tt.freq)
+			checkError(t, err, tt.err)
+			if err != nil {
+				return
+			}
+			for s, v := range tt.freq {
+				if v != 0 && (h.size[s] == 0 || h.size[s] > 16) {
+					t.Errorf("code size of %d: %d", s, h.size[s])
+				}
+			}
+		})
+	}
+}
+
+// checkError checks that err contains want, or is nil if want is empty.
+func checkError(t *testing.T, err error, want string) {
+	t.Helper()
+	switch {
+	case want == "" && err != nil:
+		t.Errorf("unexpected error: %v", err)
+	case want != "" && err == nil:
+		t.Errorf("expected error %q", want)
+	case want != "" && !strings.Contains(err.Error(), want):
+		t.Errorf("got error %q, want %q", err, want)
+	}
+}
+
+func TestProgressiveCoefficients(t *testing.T) {
+	// the same images encoded in the progressive mode, and in the sequential
+	// mode or the progressive one of the other scans
+	dir := filepath.Join(runtime.GOROOT(), "src", "image", "testdata")
+	tests := []string{
+		"video-001.jpeg",
+		"video-001.q50.410.jpeg",
+		"video-001.q50.411.jpeg",
+		"video-001.q50.420.jpeg",
+		"video-001.q50.422.jpeg",
+		"video-001.q50.440.jpeg",
+		"video-001.q50.444.jpeg",
+		"video-005.gray.q50.jpeg",
+		"video-005.gray.q50.2x2.jpeg",
+		"video-001.separate.dc.progression.jpeg",
+	}
+	for _, name := range tests {
+		t.Run(name, func(t *testing.T) {
+			sequential, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Skip(err)
+			}
+			progressive, err := os.ReadFile(filepath.Join(dir, strings.TrimSuffix(name, ".jpeg")+".progressive.jpeg"))
+			if err != nil {
+				t.Skip(err)
+			}
+
+			want := coefficients(t, sequential)
+			got := coefficients(t, progressive)
+			if got.Marker != SOF2 {
+				t.Errorf("got %s, want SOF2", markerSegmentName[got.Marker])
+			}
+			if got.Width != want.Width || got.Height != want.Height || len(got.Planes) != len(want.Planes) {
+				t.Fatalf("frame differs")
+			}
+			if got.Quant != want.Quant {
+				t.Errorf("quantization tables differ")
+			}
+			for i, p := range got.Planes {
+				// the padding blocks are not coded in the non-interleaved scans
+				for by := 0; by < p.ImageBlocksH; by++ {
+					for bx := 0; bx < p.ImageBlocksW; bx++ {
+						if *p.Block(bx, by) != *want.Planes[i].Block(bx, by) {
+							t.Fatalf("plane %d: block (%d, %d) differs", i, bx, by)
+						}
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package jpeg
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	stdjpeg "image/jpeg"
+	"io"
+)
+
+// maximum size of the regenerated Exif thumbnail
+const (
+	thumbnailWidth  = 160
+	thumbnailHeight = 120
+)
+
+// Crop writes the file cropped losslessly to w, and returns the cropped
+// rectangle. The upper-left corner of r is snapped to the MCU grid (e.g.
+// 16x16 pixels for 4:2:0) and the lower-right corner is clipped by the
+// image. The Exif PixelXDimension and PixelYDimension are updated, and the
+// Exif thumbnail is regenerated from the cropped image if thumbnail is
+// true, otherwise it is removed.
+//
+// The progressive image is written in the sequential mode.
+func (f *File) Crop(w io.Writer, r image.Rectangle, thumbnail bool) (image.Rectangle, error) {
+	if len(f.Segments) == 0 || f.Segments[0].Marker != SOI {
+		return image.Rectangle{}, errors.New("expected SOI")
+	}
+
+	src, err := f.Coefficients()
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	r = r.Intersect(image.Rect(0, 0, src.Width, src.Height))
+	if r.Empty() {
+		return image.Rectangle{}, errors.New("empty rectangle")
+	}
+	r.Min.X -= r.Min.X % (8 * src.hmax)
+	r.Min.Y -= r.Min.Y % (8 * src.vmax)
+
+	dst := src.crop(r)
+	coded, err := dst.encode()
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+
+	var thumb []byte
+	if thumbnail {
+		if thumb, err = f.newThumbnail(coded); err != nil {
+			return image.Rectangle{}, err
+		}
+	}
+
+	err = f.writeCoded(w, coded, func(d *APP1Data) ([]byte, error) {
+		return d.updateExif(dst.Width, dst.Height, false, func(b []byte) []byte {
+			return thumb
+		})
+	})
+	return r, err
+}
+
+// crop returns the coefficients of the rectangle on the MCU grid.
+func (c *Coefficients) crop(r image.Rectangle) *Coefficients {
+	dst := &Coefficients{
+		Marker:          c.Marker,
+		Precision:       c.Precision,
+		Width:           r.Dx(),
+		Height:          r.Dy(),
+		Quant:           c.Quant,
+		quantDefined:    c.quantDefined,
+		RestartInterval: c.RestartInterval,
+	}
+	for _, comp := range c.Planes {
+		dst.Planes = append(dst.Planes, &Plane{Component: comp.Component})
+	}
+	dst.allocate()
+
+	mx, my := r.Min.X/(8*c.hmax), r.Min.Y/(8*c.vmax)
+	for i, dc := range dst.Planes {
+		sc := c.Planes[i]
+		ox, oy := mx*int(sc.H), my*int(sc.V)
+		for dby := 0; dby < dc.BlocksH && oy+dby < sc.BlocksH; dby++ {
+			for dbx := 0; dbx < dc.BlocksW && ox+dbx < sc.BlocksW; dbx++ {
+				*dc.Block(dbx, dby) = *sc.Block(ox+dbx, oy+dby)
+			}
+		}
+	}
+
+	return dst
+}
+
+// newThumbnail returns the JPEG thumbnail of the re-encoded image.
+func (f *File) newThumbnail(coded []*part) ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{0xff, 0xd8})
+	for _, seg := range f.Segments {
+		if seg.Marker == APP14 {
+			// color transform
+			if _, err := seg.WriteTo(buf); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, p := range coded {
+		if err := p.writeTo(buf); err != nil {
+			return nil, err
+		}
+	}
+	buf.Write([]byte{0xff, 0xd9})
+
+	img, err := stdjpeg.Decode(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > thumbnailWidth || h > thumbnailHeight {
+		if w*thumbnailHeight > h*thumbnailWidth {
+			w, h = thumbnailWidth, h*thumbnailWidth/w
+		} else {
+			w, h = w*thumbnailHeight/h, thumbnailHeight
+		}
+		if w == 0 {
+			w = 1
+		}
+		if h == 0 {
+			h = 1
+		}
+	}
+
+	var out bytes.Buffer
+	if err := stdjpeg.Encode(&out, downsample(img, w, h), nil); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// downsample resizes the image to w x h by the box filter.
+func downsample(img image.Image, w, h int) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := b.Min.Y + (y+1)*b.Dy()/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := b.Min.X + (x+1)*b.Dx()/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var sr, sg, sb, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					r, g, b, _ := img.At(sx, sy).RGBA()
+					sr += r >> 8
+					sg += g >> 8
+					sb += b >> 8
+					n++
+				}
+			}
+			out.SetRGBA(x, y, color.RGBA{uint8(sr / n), uint8(sg / n), uint8(sb / n), 0xff})
+		}
+	}
+	return out
+}
@@ -0,0 +1,230 @@
+package jpeg
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// maximum number of the blocks in an MCU (B.2.3)
+const maxBlocksInMCU = 10
+
+// scanEncoder encodes the blocks of a scan, or counts the symbols for the
+// optimal Huffman tables if w is nil.
+type scanEncoder struct {
+	w    *bitWriter
+	freq *[2][2][256]int
+
+	dc, ac [2]*huffmanTable
+	pred   []int32
+}
+
+func (e *scanEncoder) symbol(class, id int, s uint8) {
+	if e.w == nil {
+		e.freq[class][id][s]++
+		return
+	}
+	if class == 0 {
+		e.w.encode(e.dc[id], s)
+	} else {
+		e.w.encode(e.ac[id], s)
+	}
+}
+
+func (e *scanEncoder) value(v int32, s uint8) {
+	if e.w != nil {
+		e.w.bits(extendBits(v, s), uint(s))
+	}
+}
+
+func (e *scanEncoder) block(i, id int, b *Block) {
+	// DC
+	diff := int32(b[0]) - e.pred[i]
+	e.pred[i] = int32(b[0])
+	s := category(diff)
+	e.symbol(0, id, s)
+	e.value(diff, s)
+
+	// AC
+	run := uint8(0)
+	for k := 1; k < 64; k++ {
+		v := int32(b[zigzag[k]])
+		if v == 0 {
+			run++
+			continue
+		}
+		for run > 15 {
+			// ZRL
+			e.symbol(1, id, 0xf0)
+			run -= 16
+		}
+		s := category(v)
+		e.symbol(1, id, run<<4|s)
+		e.value(v, s)
+		run = 0
+	}
+	if run > 0 {
+		// EOB
+		e.symbol(1, id, 0x00)
+	}
+}
+
+// tableID returns the Huffman table for the component: 0 for the first
+// (luminance) component and 1 for the others.
+func tableID(i int) int {
+	if i == 0 {
+		return 0
+	}
+	return 1
+}
+
+// scans returns the components of each scan: all in an interleaved scan
+// if possible, otherwise a scan per component.
+func (c *Coefficients) scans() [][]int {
+	n := 0
+	for _, comp := range c.Planes {
+		n += int(comp.H) * int(comp.V)
+	}
+	if len(c.Planes) <= 4 && n <= maxBlocksInMCU {
+		all := make([]int, len(c.Planes))
+		for i := range all {
+			all[i] = i
+		}
+		return [][]int{all}
+	}
+
+	var scans [][]int
+	for i := range c.Planes {
+		scans = append(scans, []int{i})
+	}
+	return scans
+}
+
+func (c *Coefficients) encodeScan(e *scanEncoder, scan []int) error {
+	comps := make([]*Plane, len(scan))
+	for j, i := range scan {
+		comps[j] = c.Planes[i]
+	}
+	e.pred = make([]int32, len(comps))
+
+	rst := 0
+	return c.forEachBlock(comps, func(j int, b *Block, restart bool) error {
+		if restart {
+			for k := range e.pred {
+				e.pred[k] = 0
+			}
+			if e.w != nil {
+				e.w.flush()
+				e.w.buf = append(e.w.buf, 0xff, uint8(0xd0+rst))
+				rst = (rst + 1) % 8
+			}
+		}
+		e.block(j, tableID(scan[j]), b)
+		return nil
+	})
+}
+
+// encode encodes the coefficients with the optimal Huffman tables, and
+// returns the parts of the file from DQT to the last entropy-coded data.
+func (c *Coefficients) encode() ([]*part, error) {
+	var parts []*part
+
+	// DQT
+	marker := c.Marker
+	if marker == SOF2 {
+		// sequential
+		marker = SOF
+	}
+	if c.Precision != 8 {
+		marker = SOF1
+	}
+	var dqt []byte
+	var used [4]bool
+	for _, comp := range c.Planes {
+		used[comp.Tq] = true
+	}
+	for tq, q := range c.Quant {
+		if !used[tq] {
+			continue
+		}
+		if !c.quantDefined[tq] {
+			return nil, errors.New("undefined quantization table")
+		}
+
+		pq := uint8(0)
+		for _, v := range q {
+			if v > 255 {
+				pq = 1
+				marker = SOF1
+			}
+		}
+		dqt = append(dqt, pq<<4|uint8(tq))
+		for i := 0; i < 64; i++ {
+			if pq == 0 {
+				dqt = append(dqt, uint8(q[zigzag[i]]))
+			} else {
+				dqt = binary.BigEndian.AppendUint16(dqt, q[zigzag[i]])
+			}
+		}
+	}
+	parts = append(parts, &part{marker: DQT, payload: dqt})
+
+	// SOF
+	sof := []byte{c.Precision}
+	sof = binary.BigEndian.AppendUint16(sof, uint16(c.Height))
+	sof = binary.BigEndian.AppendUint16(sof, uint16(c.Width))
+	sof = append(sof, uint8(len(c.Planes)))
+	for _, comp := range c.Planes {
+		sof = append(sof, comp.ID, comp.H<<4|comp.V, comp.Tq)
+	}
+	parts = append(parts, &part{marker: marker, payload: sof})
+
+	// DHT
+	scans := c.scans()
+	e := &scanEncoder{freq: &[2][2][256]int{}}
+	for _, scan := range scans {
+		if err := c.encodeScan(e, scan); err != nil {
+			return nil, err
+		}
+	}
+	var dht []byte
+	for id := 0; id < 2; id++ {
+		if id >= len(c.Planes) {
+			break
+		}
+		var err error
+		if e.dc[id], err = optimalHuffmanTable(e.freq[0][id]); err != nil {
+			return nil, err
+		}
+		if e.ac[id], err = optimalHuffmanTable(e.freq[1][id]); err != nil {
+			return nil, err
+		}
+		dht = append(dht, e.dc[id].marshal(0, uint8(id))...)
+		dht = append(dht, e.ac[id].marshal(1, uint8(id))...)
+	}
+	parts = append(parts, &part{marker: DHT, payload: dht})
+
+	// DRI
+	if c.RestartInterval > 0 {
+		parts = append(parts, &part{marker: DRI, payload: binary.BigEndian.AppendUint16(nil, uint16(c.RestartInterval))})
+	}
+
+	// SOS and the entropy-coded data
+	for _, scan := range scans {
+		sos := []byte{uint8(len(scan))}
+		for _, i := range scan {
+			id := uint8(tableID(i))
+			sos = append(sos, c.Planes[i].ID, id<<4|id)
+		}
+		sos = append(sos, 0, 63, 0)
+		parts = append(parts, &part{marker: SOS, payload: sos})
+
+		e.w = &bitWriter{}
+		if err := c.encodeScan(e, scan); err != nil {
+			return nil, err
+		}
+		e.w.flush()
+		parts = append(parts, &part{marker: Data, payload: e.w.buf})
+	}
+
+	return parts, nil
+}
@@ -1,6 +1,7 @@
 package jpeg
 
 import (
+	"bufio"
 	"encoding/binary"
 	"errors"
 	"io"
@@ -19,6 +20,16 @@ func NewFile(sr *io.SectionReader) (*File, error) {
 	return f, nil
 }
 
+// Size returns the size of the file in bytes.
+func (f *File) Size() int64 {
+	return f.reader.Size()
+}
+
+// Section returns a reader of n bytes of the file starting at offset off.
+func (f *File) Section(off, n int64) *io.SectionReader {
+	return io.NewSectionReader(f.reader, off, n)
+}
+
 func readMarkerLength(r io.Reader) (marker uint16, length uint16, e error) {
 	var buf uint16
 	if err := binary.Read(r, binary.BigEndian, &buf); err != nil {
@@ -55,27 +66,6 @@ func (f *File) Parse() error {
 		f.Segments = append(f.Segments, seg)
 	}
 
-	// APP1(Exif) or APP0(JFIF)
-	{
-		marker, length, err := readMarkerLength(f.reader)
-		if err != nil || (marker != APP1 && marker != APP0) || length < 2 {
-			return errors.New("expected APP1/0")
-		}
-
-		length -= 2 // length includes 'length uint16' itself.
-		offset += 4 // 'marker uint16' + 'length uint16'
-		seg := &Segment{marker, int64(length), offset, io.NewSectionReader(f.reader, offset, int64(length)), nil}
-		if err := seg.Parse(); err != nil {
-			return err
-		}
-		f.Segments = append(f.Segments, seg)
-
-		offset, err = f.reader.Seek(int64(length), io.SeekCurrent)
-		if err != nil {
-			return errors.New("invalid length of APP1/0")
-		}
-	}
-
 	// other segments
 	for {
 		marker, length, err := readMarkerLength(f.reader)
@@ -104,8 +94,7 @@ func (f *File) Parse() error {
 
 	// data
 	{
-		end, err := f.reader.Seek(-2, io.SeekEnd)
-		length := end - offset
+		length, err := scanEntropyCodedData(io.NewSectionReader(f.reader, offset, f.reader.Size()-offset), nil)
 		if err != nil || length <= 0 {
 			return errors.New("invalid length of data")
 		}
@@ -117,6 +106,9 @@ func (f *File) Parse() error {
 		f.Segments = append(f.Segments, seg)
 
 		offset += length
+		if _, err := f.reader.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
 	}
 
 	// EOI
@@ -134,5 +126,89 @@ func (f *File) Parse() error {
 		f.Segments = append(f.Segments, seg)
 	}
 
+	// trailer (e.g. MPF individual images, Motion Photo)
+	if length := f.reader.Size() - offset; length > 0 {
+		seg := &Segment{Trailer, length, offset, io.NewSectionReader(f.reader, offset, length), nil}
+		if err := seg.Parse(); err != nil {
+			return err
+		}
+		f.Segments = append(f.Segments, seg)
+	}
+
 	return nil
 }
+
+// scanEntropyCodedData returns the length of the entropy-coded data
+// (including RSTn and the marker segments between scans) up to EOI.
+// If segment is not nil, it is called for each marker segment between
+// scans with the offset of the marker and the length of the payload.
+func scanEntropyCodedData(sr *io.SectionReader, segment func(marker uint16, offset, length int64) error) (int64, error) {
+	r := bufio.NewReader(sr)
+
+	var pos int64
+	readByte := func() (byte, error) {
+		b, err := r.ReadByte()
+		if err == nil {
+			pos++
+		}
+		return b, err
+	}
+
+	for {
+		b, err := readByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != 0xff {
+			continue
+		}
+
+		// fill bytes
+		m, err := readByte()
+		for err == nil && m == 0xff {
+			m, err = readByte()
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		switch {
+		case m == 0x00:
+			// stuffed zero
+		case 0xd0 <= m && m <= 0xd7:
+			// RSTn
+		case m == 0xd9:
+			// EOI
+			return pos - 2, nil
+		default:
+			// marker segment between scans (DHT, SOS, DNL, ...)
+			var length uint16
+			if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+				return 0, err
+			}
+			if length < 2 {
+				return 0, errors.New("invalid segment")
+			}
+			if segment != nil {
+				if err := segment(0xff00|uint16(m), pos-2, int64(length)-2); err != nil {
+					return 0, err
+				}
+			}
+			if _, err := r.Discard(int(length) - 2); err != nil {
+				return 0, err
+			}
+			pos += int64(length)
+		}
+	}
+}
+
+// End returns the offset just after EOI of the image, i.e. the beginning
+// of the trailer.
+func (f *File) End() int64 {
+	for _, seg := range f.Segments {
+		if seg.Marker == EOI {
+			return seg.payloadFileOffset
+		}
+	}
+	return f.Size()
+}
@@ -0,0 +1,40 @@
+package jpeg
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ContentHash returns SHA-256 of the coded image independent of the
+// metadata: the frame header, the tables, the scan headers and the
+// entropy-coded data. APPn, COM and the trailer are excluded, so the files
+// differing only in Exif, XMP, etc. have the same hash.
+func (f *File) ContentHash() ([]byte, error) {
+	h := sha256.New()
+	hasData := false
+	for _, seg := range f.Segments {
+		switch seg.Marker {
+		case SOF, SOF1, SOF2, SOF3, SOF9, SOF10, SOF11, DQT, DHT, DRI, SOS:
+			// marker and length before the payload
+			if err := binary.Write(h, binary.BigEndian, seg.Marker); err != nil {
+				return nil, err
+			}
+			if err := binary.Write(h, binary.BigEndian, uint16(seg.Length+2)); err != nil {
+				return nil, err
+			}
+		case Data:
+			hasData = true
+		default:
+			continue
+		}
+		if _, err := io.Copy(h, io.NewSectionReader(seg.reader, 0, seg.Length)); err != nil {
+			return nil, err
+		}
+	}
+	if !hasData {
+		return nil, errors.New("no entropy-coded data")
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,397 @@
+package jpeg
+
+import (
+	"errors"
+	"fmt"
+)
+
+// zigzag maps the zigzag order to the natural order.
+var zigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// Zigzag returns the index in the natural order of the k-th coefficient in
+// the zigzag order.
+func Zigzag(k int) int {
+	return zigzag[k]
+}
+
+// huffmanTable is a Huffman table of DHT (Annex C).
+type huffmanTable struct {
+	counts  [16]uint8 // number of the codes of each length
+	symbols []uint8
+
+	// decoder (F.2.2.3)
+	maxcode [18]int32
+	valptr  [17]int32
+	mincode [17]int32
+
+	// encoder
+	code [256]uint16
+	size [256]uint8
+}
+
+func newHuffmanTable(counts [16]uint8, symbols []uint8) (*huffmanTable, error) {
+	t := &huffmanTable{counts: counts, symbols: symbols}
+
+	n := 0
+	for _, c := range counts {
+		n += int(c)
+	}
+	if n != len(symbols) || n > 256 {
+		return nil, errors.New("invalid Huffman table")
+	}
+
+	// code sizes and codes
+	sizes := make([]uint8, 0, n)
+	for l, c := range counts {
+		for i := 0; i < int(c); i++ {
+			sizes = append(sizes, uint8(l+1))
+		}
+	}
+	codes := make([]int32, n)
+	code := int32(0)
+	k := 0
+	for l := uint8(1); l <= 16; l++ {
+		for k < n && sizes[k] == l {
+			codes[k] = code
+			code++
+			k++
+		}
+		if code > 1<<l {
+			return nil, errors.New("invalid Huffman table")
+		}
+		code <<= 1
+	}
+
+	j := int32(0)
+	for l := 1; l <= 16; l++ {
+		if counts[l-1] == 0 {
+			t.maxcode[l] = -1
+			continue
+		}
+		t.valptr[l] = j
+		t.mincode[l] = codes[j]
+		j += int32(counts[l-1]) - 1
+		t.maxcode[l] = codes[j]
+		j++
+	}
+	t.maxcode[17] = 0x7fffffff
+
+	for i, s := range symbols {
+		t.code[s] = uint16(codes[i])
+		t.size[s] = sizes[i]
+	}
+
+	return t, nil
+}
+
+// parseDHT parses the Huffman tables of DHT into tables[class][id].
+func parseDHT(b []byte, tables *[2][4]*huffmanTable) error {
+	for len(b) > 0 {
+		if len(b) < 17 {
+			return errors.New("short DHT")
+		}
+		class, id := b[0]>>4, b[0]&0x0f
+		if class > 1 || id > 3 {
+			return fmt.Errorf("invalid Huffman table: %02x", b[0])
+		}
+		var counts [16]uint8
+		copy(counts[:], b[1:17])
+		n := 0
+		for _, c := range counts {
+			n += int(c)
+		}
+		b = b[17:]
+		if len(b) < n {
+			return errors.New("short DHT")
+		}
+
+		t, err := newHuffmanTable(counts, append([]uint8(nil), b[:n]...))
+		if err != nil {
+			return err
+		}
+		tables[class][id] = t
+		b = b[n:]
+	}
+	return nil
+}
+
+// marshal encodes the table into the DHT payload.
+func (t *huffmanTable) marshal(class, id uint8) []byte {
+	b := []byte{class<<4 | id}
+	b = append(b, t.counts[:]...)
+	return append(b, t.symbols...)
+}
+
+// maximum code size before limiting to 16 bits (MAX_CLEN of libjpeg)
+const maxCodeSize = 32
+
+// optimalHuffmanTable generates the optimal table for the frequencies of
+// the symbols limited to 16 bits (K.2).
+func optimalHuffmanTable(freq [256]int) (*huffmanTable, error) {
+	var f [257]int
+	copy(f[:], freq[:])
+	used := false
+	for _, v := range freq {
+		used = used || v != 0
+	}
+	if !used {
+		// a table must have a code at least
+		f[0] = 1
+	}
+	// reserved code point not to use the code of all 1s
+	f[256] = 1
+
+	var codesize [257]int
+	var others [257]int
+	for i := range others {
+		others[i] = -1
+	}
+
+	for {
+		// the least frequency, and the next least one
+		c1, c2 := -1, -1
+		v := int(^uint(0) >> 1)
+		for i := 0; i <= 256; i++ {
+			if f[i] != 0 && f[i] <= v {
+				v = f[i]
+				c1 = i
+			}
+		}
+		v = int(^uint(0) >> 1)
+		for i := 0; i <= 256; i++ {
+			if f[i] != 0 && f[i] <= v && i != c1 {
+				v = f[i]
+				c2 = i
+			}
+		}
+		if c2 < 0 {
+			break
+		}
+
+		f[c1] += f[c2]
+		f[c2] = 0
+
+		codesize[c1]++
+		for others[c1] >= 0 {
+			c1 = others[c1]
+			codesize[c1]++
+		}
+		others[c1] = c2
+
+		codesize[c2]++
+		for others[c2] >= 0 {
+			c2 = others[c2]
+			codesize[c2]++
+		}
+	}
+
+	var bits [maxCodeSize + 1]int
+	for i := 0; i <= 256; i++ {
+		if codesize[i] > maxCodeSize {
+			return nil, errors.New("Huffman code size table overflow")
+		}
+		if codesize[i] != 0 {
+			bits[codesize[i]]++
+		}
+	}
+
+	// limit the code length to 16 bits
+	for i := maxCodeSize; i > 16; i-- {
+		for bits[i] > 0 {
+			j := i - 2
+			for bits[j] == 0 {
+				j--
+			}
+			bits[i] -= 2
+			bits[i-1]++
+			bits[j+1] += 2
+			bits[j]--
+		}
+	}
+	// remove the reserved code point
+	i := 16
+	for bits[i] == 0 {
+		i--
+	}
+	bits[i]--
+
+	var counts [16]uint8
+	for l := 1; l <= 16; l++ {
+		counts[l-1] = uint8(bits[l])
+	}
+	var symbols []uint8
+	for l := 1; l <= maxCodeSize; l++ {
+		for s := 0; s < 256; s++ {
+			if codesize[s] == l {
+				symbols = append(symbols, uint8(s))
+			}
+		}
+	}
+
+	return newHuffmanTable(counts, symbols)
+}
+
+// bitReader reads the entropy-coded data removing the stuffed zeros.
+// It feeds zeros after a marker.
+type bitReader struct {
+	data []byte
+	pos  int
+
+	acc uint32
+	n   uint
+
+	marker bool
+	// bytes of zeros filled after the data or a marker
+	padded int
+}
+
+// overrun reports that the bits beyond the data have been read.
+func (r *bitReader) overrun() bool {
+	return r.padded*8 > int(r.n)
+}
+
+func (r *bitReader) fill() {
+	for r.n <= 24 {
+		var b byte
+		if r.marker || r.pos >= len(r.data) {
+			r.padded++
+		} else {
+			b = r.data[r.pos]
+			if b == 0xff {
+				if r.pos+1 < len(r.data) && r.data[r.pos+1] == 0x00 {
+					r.pos += 2
+				} else {
+					r.marker = true
+					r.padded++
+					b = 0
+				}
+			} else {
+				r.pos++
+			}
+		}
+		r.acc |= uint32(b) << (24 - r.n)
+		r.n += 8
+	}
+}
+
+func (r *bitReader) bits(n uint) int32 {
+	if n == 0 {
+		return 0
+	}
+	if r.n < n {
+		r.fill()
+	}
+	v := int32(r.acc >> (32 - n))
+	r.acc <<= n
+	r.n -= n
+	return v
+}
+
+// receiveExtend reads the value of the category s (F.2.2.1).
+func (r *bitReader) receiveExtend(s uint8) int32 {
+	if s == 0 {
+		return 0
+	}
+	v := r.bits(uint(s))
+	if v < 1<<(s-1) {
+		v += -1<<s + 1
+	}
+	return v
+}
+
+func (r *bitReader) decode(t *huffmanTable) (uint8, error) {
+	if t == nil {
+		return 0, errors.New("undefined Huffman table")
+	}
+	code := r.bits(1)
+	l := 1
+	for code > t.maxcode[l] {
+		code = code<<1 | r.bits(1)
+		l++
+		if l > 16 {
+			return 0, errors.New("invalid Huffman code")
+		}
+	}
+	return t.symbols[t.valptr[l]+code-t.mincode[l]], nil
+}
+
+// restart discards the remaining bits and skips RSTn.
+func (r *bitReader) restart() error {
+	r.acc, r.n = 0, 0
+	r.marker, r.padded = false, 0
+	for r.pos < len(r.data) && r.data[r.pos] == 0xff && r.pos+1 < len(r.data) && r.data[r.pos+1] == 0xff {
+		// fill bytes
+		r.pos++
+	}
+	if r.pos+1 >= len(r.data) || r.data[r.pos] != 0xff || r.data[r.pos+1] < 0xd0 || r.data[r.pos+1] > 0xd7 {
+		return fmt.Errorf("expected RSTn at %08x", r.pos)
+	}
+	r.pos += 2
+	return nil
+}
+
+// bitWriter writes the entropy-coded data stuffing zeros.
+type bitWriter struct {
+	buf []byte
+
+	acc uint32
+	n   uint
+}
+
+func (w *bitWriter) bits(v uint32, n uint) {
+	if n == 0 {
+		return
+	}
+	w.acc |= (v & (1<<n - 1)) << (32 - w.n - n)
+	w.n += n
+	for w.n >= 8 {
+		b := byte(w.acc >> 24)
+		w.buf = append(w.buf, b)
+		if b == 0xff {
+			w.buf = append(w.buf, 0x00)
+		}
+		w.acc <<= 8
+		w.n -= 8
+	}
+}
+
+// flush pads the remaining bits with 1s.
+func (w *bitWriter) flush() {
+	if w.n > 0 {
+		w.bits(0x7f, 8-w.n)
+	}
+}
+
+func (w *bitWriter) encode(t *huffmanTable, s uint8) {
+	w.bits(uint32(t.code[s]), uint(t.size[s]))
+}
+
+// category returns the number of bits of the value (F.1.2.1).
+func category(v int32) uint8 {
+	if v < 0 {
+		v = -v
+	}
+	var s uint8
+	for v > 0 {
+		s++
+		v >>= 1
+	}
+	return s
+}
+
+// extendBits returns the bits of the value of the category.
+func extendBits(v int32, s uint8) uint32 {
+	if v < 0 {
+		v--
+	}
+	return uint32(v) & (1<<s - 1)
+}
@@ -0,0 +1,40 @@
+package jpeg
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ICCProfile returns the ICC profile of the file, or nil if the file has no
+// ICC profile. The profile split across APP2 segments is reassembled in
+// the order of the sequence numbers.
+func (f *File) ICCProfile() ([]byte, error) {
+	var chunks []*APP2Data
+	for _, seg := range f.Segments {
+		if app2, ok := seg.parsedData.(*APP2Data); ok && app2.identifier == iccIdentifier && app2.err == nil {
+			chunks = append(chunks, app2)
+		}
+	}
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+
+	count := int(chunks[0].iccCount)
+	if count != len(chunks) {
+		return nil, fmt.Errorf("ICC profile: %d of %d chunks", len(chunks), count)
+	}
+	ordered := make([]*APP2Data, count)
+	for _, chunk := range chunks {
+		seq := int(chunk.iccSeq)
+		if int(chunk.iccCount) != count || seq < 1 || seq > count || ordered[seq-1] != nil {
+			return nil, errors.New("invalid sequence of ICC profile chunks")
+		}
+		ordered[seq-1] = chunk
+	}
+
+	var profile []byte
+	for _, chunk := range ordered {
+		profile = append(profile, chunk.icc...)
+	}
+	return profile, nil
+}
@@ -0,0 +1,250 @@
+package jpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// COMData is the Comment
+type COMData struct {
+	SegmentData
+
+	Charset string // "ASCII", "UTF-8", "UTF-16BE", "UTF-16LE" or "ISO-8859-1"
+	Text    string // converted into UTF-8
+}
+
+// Parse parses COM data.
+func (d *COMData) Parse(segment *Segment) error {
+	b, err := io.ReadAll(io.NewSectionReader(segment.reader, 0, segment.Length))
+	if err != nil {
+		return err
+	}
+	d.Charset, d.Text = decodeComment(b)
+	return nil
+}
+
+// decodeComment detects the charset of the comment, and converts it into
+// UTF-8. The charset is not specified by JPEG, so the BOM, ASCII and UTF-8
+// are tried in order, and ISO-8859-1 is assumed for the others.
+func decodeComment(b []byte) (string, string) {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xef, 0xbb, 0xbf}):
+		return "UTF-8", trimNUL(string(b[3:]))
+	case bytes.HasPrefix(b, []byte{0xfe, 0xff}):
+		return "UTF-16BE", trimNUL(decodeUTF16(b[2:], binary.BigEndian))
+	case bytes.HasPrefix(b, []byte{0xff, 0xfe}):
+		return "UTF-16LE", trimNUL(decodeUTF16(b[2:], binary.LittleEndian))
+	}
+
+	ascii := true
+	for _, c := range b {
+		if c >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return "ASCII", trimNUL(string(b))
+	}
+	if utf8.Valid(b) {
+		return "UTF-8", trimNUL(string(b))
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return "ISO-8859-1", trimNUL(string(runes))
+}
+
+func decodeUTF16(b []byte, order binary.ByteOrder) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = order.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
+
+// trimNUL trims the NUL terminator written by some encoders.
+func trimNUL(s string) string {
+	return strings.TrimRight(s, "\x00")
+}
+
+// String makes COMData satisfy the Stringer interface.
+func (d *COMData) String() string {
+	return fmt.Sprintf("  charset: %s\n  text: %q\n", d.Charset, d.Text)
+}
+
+// Comments returns the COM data of the file.
+func (f *File) Comments() []*COMData {
+	var coms []*COMData
+	for _, seg := range f.Segments {
+		if com, ok := seg.parsedData.(*COMData); ok {
+			coms = append(coms, com)
+		}
+	}
+	return coms
+}
+
+// DRIData is the Define Restart Interval
+type DRIData struct {
+	SegmentData
+
+	Interval uint16 // in MCUs, 0 disables the restart
+
+	err error
+}
+
+// Parse parses DRI data. The segment of the invalid length is kept
+// unparsed with the error.
+func (d *DRIData) Parse(segment *Segment) error {
+	if segment.Length != 2 {
+		d.err = fmt.Errorf("invalid length of DRI: %d", segment.Length)
+		return nil
+	}
+	d.err = binary.Read(io.NewSectionReader(segment.reader, 0, 2), binary.BigEndian, &d.Interval)
+	return nil
+}
+
+// String makes DRIData satisfy the Stringer interface.
+func (d *DRIData) String() string {
+	if d.err != nil {
+		return fmt.Sprintf("  invalid: %v\n", d.err)
+	}
+	return fmt.Sprintf("  restart interval: %d\n", d.Interval)
+}
+
+// DNLData is the Define Number of Lines
+type DNLData struct {
+	SegmentData
+
+	Lines uint16 // overrides the height 0 of SOF
+
+	err error
+}
+
+// Parse parses DNL data. The invalid segment is kept unparsed with the
+// error.
+func (d *DNLData) Parse(segment *Segment) error {
+	if segment.Length != 2 {
+		d.err = fmt.Errorf("invalid length of DNL: %d", segment.Length)
+		return nil
+	}
+	if err := binary.Read(io.NewSectionReader(segment.reader, 0, 2), binary.BigEndian, &d.Lines); err != nil {
+		d.err = err
+		return nil
+	}
+	if d.Lines == 0 {
+		d.err = errors.New("invalid number of lines of DNL")
+	}
+	return nil
+}
+
+// String makes DNLData satisfy the Stringer interface.
+func (d *DNLData) String() string {
+	if d.err != nil {
+		return fmt.Sprintf("  invalid: %v\n", d.err)
+	}
+	return fmt.Sprintf("  number of lines: %d\n", d.Lines)
+}
+
+// DNL returns the DNL data following the first scan, or nil if the file has
+// no DNL. The height of the frame is defined by DNL if the one of SOF is 0.
+func (f *File) DNL() *DNLData {
+	for _, seg := range f.Segments {
+		data, ok := seg.parsedData.(*EntropyCodedData)
+		if !ok {
+			continue
+		}
+		for _, s := range data.Segments {
+			if dnl, ok := s.parsedData.(*DNLData); ok && dnl.err == nil {
+				return dnl
+			}
+		}
+	}
+	return nil
+}
+
+// EXPData is the Expand Reference Components (hierarchical mode)
+type EXPData struct {
+	SegmentData
+
+	Horizontal bool // Eh
+	Vertical   bool // Ev
+
+	err error
+}
+
+// Parse parses EXP data. The segment of the invalid length is kept
+// unparsed with the error.
+func (d *EXPData) Parse(segment *Segment) error {
+	if segment.Length != 1 {
+		d.err = fmt.Errorf("invalid length of EXP: %d", segment.Length)
+		return nil
+	}
+	var b [1]byte
+	if _, err := segment.reader.ReadAt(b[:], 0); err != nil {
+		d.err = err
+		return nil
+	}
+	d.Horizontal = b[0]>>4 != 0
+	d.Vertical = b[0]&0xf != 0
+	return nil
+}
+
+// String makes EXPData satisfy the Stringer interface.
+func (d *EXPData) String() string {
+	if d.err != nil {
+		return fmt.Sprintf("  invalid: %v\n", d.err)
+	}
+	return fmt.Sprintf("  expand: horizontal=%v, vertical=%v\n", d.Horizontal, d.Vertical)
+}
+
+// EntropyCodedData is the entropy-coded data including the marker segments
+// between scans (DHT, SOS, DNL, ...).
+type EntropyCodedData struct {
+	SegmentData
+
+	Segments []*Segment
+}
+
+// Parse parses the marker segments in the entropy-coded data.
+func (d *EntropyCodedData) Parse(segment *Segment) error {
+	d.Segments = nil
+	_, err := scanEntropyCodedData(io.NewSectionReader(segment.reader, 0, segment.Length), func(marker uint16, offset, length int64) error {
+		offset += 4 // 'marker uint16' + 'length uint16'
+		if offset+length > segment.Length {
+			return errors.New("invalid segment")
+		}
+		seg := &Segment{marker, length, segment.payloadFileOffset + offset, io.NewSectionReader(segment.reader, offset, length), nil}
+		if err := seg.Parse(); err != nil {
+			return err
+		}
+		d.Segments = append(d.Segments, seg)
+		return nil
+	})
+	if err == io.EOF {
+		// EOI is not included in the data
+		return nil
+	}
+	return err
+}
+
+// String makes EntropyCodedData satisfy the Stringer interface.
+func (d *EntropyCodedData) String() string {
+	var buf bytes.Buffer
+	for _, seg := range d.Segments {
+		buf.WriteString(fmt.Sprintf("  %s\n", seg))
+		for _, line := range strings.SplitAfter(seg.parsedData.String(), "\n") {
+			if line != "" {
+				buf.WriteString("  " + line)
+			}
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,337 @@
+package jpeg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Metadata is the metadata written by WriteMetadata. A nil field keeps the
+// metadata of the file, and an empty (non-nil) one removes it.
+type Metadata struct {
+	// TIFF stream of Exif
+	Exif []byte
+
+	// StandardXMP and ExtendedXMP
+	XMP *XMP
+
+	// ICC profile
+	ICC []byte
+
+	// IPTC-IIM datasets, stored as the resource 0x0404 of Photoshop IRB
+	// with the other resources of the file
+	IPTC []byte
+}
+
+// kind of the metadata segment
+const (
+	kindOther = iota
+	kindAPP0
+	kindExif
+	kindXMP
+	kindICC
+	kindPhotoshop
+)
+
+func metadataKind(seg *Segment) int {
+	switch d := seg.parsedData.(type) {
+	case *APP0Data:
+		return kindAPP0
+	case *APP1Data:
+		if d.exif != nil {
+			return kindExif
+		}
+		if d.identifier == xmpIdentifier || d.identifier == extendedXMPIdentifier {
+			return kindXMP
+		}
+	case *APP2Data:
+		if d.identifier == iccIdentifier {
+			return kindICC
+		}
+	case *APP13Data:
+		if d.identifier == photoshopIdentifier {
+			return kindPhotoshop
+		}
+	}
+	return kindOther
+}
+
+// part is a segment of the new file: the segment of the file, or the new
+// payload of the marker. The payload of Data is the raw entropy-coded data.
+type part struct {
+	seg     *Segment
+	marker  uint16
+	payload []byte
+}
+
+func (p *part) size() int64 {
+	if p.seg == nil {
+		if p.marker == Data {
+			return int64(len(p.payload))
+		}
+		return 4 + int64(len(p.payload))
+	}
+	switch p.seg.Marker {
+	case Data, Trailer:
+		return p.seg.Length
+	case SOI, EOI:
+		return 2
+	}
+	return 4 + p.seg.Length
+}
+
+func (p *part) writeTo(w io.Writer) error {
+	if p.seg != nil {
+		_, err := p.seg.WriteTo(w)
+		return err
+	}
+	if p.marker == Data {
+		_, err := w.Write(p.payload)
+		return err
+	}
+	return writeSegment(w, p.marker, p.payload)
+}
+
+// writeParts writes parts to w updating MPF.
+func (f *File) writeParts(w io.Writer, parts []*part) error {
+	if err := f.relocateMPF(parts); err != nil {
+		return err
+	}
+	for _, p := range parts {
+		if err := p.writeTo(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteMetadata writes the file with the metadata to w without re-encoding
+// the image. The metadata segments are placed after SOI and APP0 in the
+// order of Exif, XMP (StandardXMP, ExtendedXMP), ICC profile and Photoshop
+// IRB, and the payloads over the size of a segment are split. The other
+// segments follow in the original order, and the MP Entry of MPF is
+// updated for the new layout.
+func (f *File) WriteMetadata(w io.Writer, m *Metadata) error {
+	if len(f.Segments) == 0 || f.Segments[0].Marker != SOI {
+		return errors.New("expected SOI")
+	}
+
+	parts := []*part{{seg: f.Segments[0]}}
+	existing := func(kind int) {
+		for _, seg := range f.Segments {
+			if metadataKind(seg) == kind {
+				parts = append(parts, &part{seg: seg})
+			}
+		}
+	}
+	payloads := func(marker uint16, payloads [][]byte) {
+		for _, payload := range payloads {
+			parts = append(parts, &part{marker: marker, payload: payload})
+		}
+	}
+
+	existing(kindAPP0)
+
+	// Exif
+	if m.Exif == nil {
+		existing(kindExif)
+	} else if len(m.Exif) > 0 {
+		payload := append([]byte("Exif\x00\x00"), m.Exif...)
+		if len(payload) > maxSegmentPayloadSize {
+			return fmt.Errorf("too large Exif: %d[bytes]", len(m.Exif))
+		}
+		payloads(APP1, [][]byte{payload})
+	}
+
+	// XMP
+	if m.XMP == nil {
+		existing(kindXMP)
+	} else if len(m.XMP.Standard) > 0 {
+		p, err := m.XMP.Payloads()
+		if err != nil {
+			return err
+		}
+		payloads(APP1, p)
+	}
+
+	// ICC profile
+	if m.ICC == nil {
+		existing(kindICC)
+	} else if len(m.ICC) > 0 {
+		p, err := iccPayloads(m.ICC)
+		if err != nil {
+			return err
+		}
+		payloads(APP2, p)
+	}
+
+	// Photoshop IRB
+	if m.IPTC == nil {
+		existing(kindPhotoshop)
+	} else {
+		resources, err := f.PhotoshopResources()
+		if err != nil {
+			return err
+		}
+		var replaced []*PhotoshopResource
+		for _, r := range resources {
+			if r.ID != ResourceIPTCNAA {
+				replaced = append(replaced, r)
+			}
+		}
+		if len(m.IPTC) > 0 {
+			replaced = append(replaced, &PhotoshopResource{Signature: "8BIM", ID: ResourceIPTCNAA, Data: m.IPTC})
+		}
+		if len(replaced) > 0 {
+			payloads(APP13, splitPayload(photoshopIdentifier+"\x00", marshalPhotoshopResources(replaced)))
+		}
+	}
+
+	// the others
+	for _, seg := range f.Segments[1:] {
+		if metadataKind(seg) == kindOther {
+			parts = append(parts, &part{seg: seg})
+		}
+	}
+
+	return f.writeParts(w, parts)
+}
+
+// relocateMPF replaces the MPF segment in parts with the one updated for
+// the offsets in the new file.
+func (f *File) relocateMPF(parts []*part) error {
+	mpf := f.MPF()
+	if mpf == nil {
+		return nil
+	}
+
+	var mpfPart *part
+	var offsetBase, end, pos int64
+	trailer := false
+	for _, p := range parts {
+		if p.seg != nil {
+			if app2, ok := p.seg.parsedData.(*APP2Data); ok && app2.mpf == mpf {
+				mpfPart = p
+				offsetBase = pos + 4 + int64(len("MPF\x00"))
+			}
+			if p.seg.Marker == EOI {
+				end = pos + p.size()
+			}
+			trailer = trailer || p.seg.Marker == Trailer
+		}
+		pos += p.size()
+	}
+	if mpfPart == nil {
+		// MPF is not written
+		return nil
+	}
+	if end == 0 {
+		return errors.New("invalid MPF")
+	}
+	for _, img := range mpf.Images {
+		if img.FileOffset != 0 && !trailer {
+			return errors.New("MP images are not written with MPF")
+		}
+	}
+
+	payload := make([]byte, mpfPart.seg.Length)
+	if _, err := mpfPart.seg.reader.ReadAt(payload, 0); err != nil {
+		return err
+	}
+	if err := mpf.relocate(payload, offsetBase, end, end-f.End()); err != nil {
+		return err
+	}
+	mpfPart.seg, mpfPart.marker, mpfPart.payload = nil, APP2, payload
+	return nil
+}
+
+// iccPayloads splits the ICC profile into the APP2 payloads with the
+// sequence numbers.
+func iccPayloads(profile []byte) ([][]byte, error) {
+	header := len(iccIdentifier) + 1 + 2
+	chunkSize := maxSegmentPayloadSize - header
+	count := (len(profile) + chunkSize - 1) / chunkSize
+	if count > 255 {
+		return nil, fmt.Errorf("too large ICC profile: %d[bytes]", len(profile))
+	}
+
+	var payloads [][]byte
+	for i := 0; i < count; i++ {
+		end := (i + 1) * chunkSize
+		if end > len(profile) {
+			end = len(profile)
+		}
+		payload := make([]byte, 0, header+end-i*chunkSize)
+		payload = append(payload, iccIdentifier...)
+		payload = append(payload, 0, uint8(i+1), uint8(count))
+		payload = append(payload, profile[i*chunkSize:end]...)
+		payloads = append(payloads, payload)
+	}
+	return payloads, nil
+}
+
+// splitPayload splits b into the payloads with the identifier.
+func splitPayload(identifier string, b []byte) [][]byte {
+	chunkSize := maxSegmentPayloadSize - len(identifier)
+	var payloads [][]byte
+	for offset := 0; offset < len(b); offset += chunkSize {
+		end := offset + chunkSize
+		if end > len(b) {
+			end = len(b)
+		}
+		payload := make([]byte, 0, len(identifier)+end-offset)
+		payload = append(payload, identifier...)
+		payload = append(payload, b[offset:end]...)
+		payloads = append(payloads, payload)
+	}
+	return payloads
+}
+
+// UpdateFile rewrites the JPEG file of name with the metadata. The file is
+// replaced atomically by renaming a temporary file in the same directory.
+func UpdateFile(name string, m *Metadata) (err error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	stat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	f, err := NewFile(io.NewSectionReader(src, 0, stat.Size()))
+	if err != nil {
+		return err
+	}
+	if err := f.Parse(); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = f.WriteMetadata(tmp, m); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(stat.Mode().Perm()); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
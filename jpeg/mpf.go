@@ -0,0 +1,245 @@
+package jpeg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ysh86/lspic/tiff"
+)
+
+// MP Index IFD / MP Attribute IFD Tag (CIPA DC-007)
+const (
+	MPFVersion      uint16 = 0xb000
+	NumberOfImages  uint16 = 0xb001
+	MPEntry         uint16 = 0xb002
+	ImageUIDList    uint16 = 0xb003
+	TotalFrames     uint16 = 0xb004
+	MPIndividualNum uint16 = 0xb101
+)
+
+// MP Type code
+const (
+	MPTypeUndefined         uint32 = 0x000000
+	MPTypeLargeThumbnailVGA uint32 = 0x010001
+	MPTypeLargeThumbnailHD  uint32 = 0x010002
+	MPTypePanorama          uint32 = 0x020001
+	MPTypeDisparity         uint32 = 0x020002
+	MPTypeMultiAngle        uint32 = 0x020003
+	MPTypeBaselinePrimary   uint32 = 0x030000
+)
+
+var mpTypeName map[uint32]string
+
+func init() {
+	mpTypeName = map[uint32]string{
+		MPTypeUndefined:         "Undefined",
+		MPTypeLargeThumbnailVGA: "Large Thumbnail (VGA)",
+		MPTypeLargeThumbnailHD:  "Large Thumbnail (Full HD)",
+		MPTypePanorama:          "Multi-Frame Panorama",
+		MPTypeDisparity:         "Multi-Frame Disparity",
+		MPTypeMultiAngle:        "Multi-Frame Multi-Angle",
+		MPTypeBaselinePrimary:   "Baseline MP Primary Image",
+	}
+}
+
+// MPF is the Multi-Picture Format data in APP2.
+type MPF struct {
+	Version string
+
+	// MP Index IFD (only in the first individual image)
+	Images []*MPImage
+
+	// MP Attribute IFD of this individual image
+	Attributes []*tiff.IFDEntry
+
+	// file offset of the MP Header (endian)
+	offsetBase int64
+
+	index *tiff.File
+}
+
+// MPImage is an individual image listed in the MP Entry.
+type MPImage struct {
+	Attribute  uint32
+	Size       int64
+	Offset     int64 // relative to the MP Header, 0 for the first image
+	Dependent1 uint16
+	Dependent2 uint16
+
+	// absolute offset in the file
+	FileOffset int64
+
+	// MP Attribute IFD of the image (loaded by File.MPImages)
+	Attributes []*tiff.IFDEntry
+}
+
+// Type returns the MP Type code of the image.
+func (i *MPImage) Type() uint32 {
+	return i.Attribute & 0x00ffffff
+}
+
+// TypeName returns the name of the MP Type code.
+func (i *MPImage) TypeName() string {
+	name, ok := mpTypeName[i.Type()]
+	if !ok {
+		name = fmt.Sprintf("%06x", i.Type())
+	}
+	return name
+}
+
+// IsJPEG returns that the image data format is JPEG or not.
+func (i *MPImage) IsJPEG() bool {
+	return (i.Attribute>>24)&0x7 == 0
+}
+
+func (m *MPF) parse(sr *io.SectionReader, globalOffset int64) error {
+	m.offsetBase = globalOffset
+
+	var err error
+	m.index, err = tiff.NewFile(sr, globalOffset)
+	if err != nil {
+		return err
+	}
+	if err := m.index.Parse(); err != nil {
+		return err
+	}
+
+	if e := m.index.Entry(0, MPFVersion); e != nil {
+		version, err := m.index.RawValue(e)
+		if err != nil {
+			return err
+		}
+		m.Version = string(version)
+	}
+
+	// MP Index IFD + MP Attribute IFD, or MP Attribute IFD only
+	attr := 0
+	if e := m.index.Entry(0, MPEntry); e != nil {
+		raw, err := m.index.RawValue(e)
+		if err != nil {
+			return err
+		}
+		if len(raw)%16 != 0 {
+			return errors.New("invalid length of MP Entry")
+		}
+
+		bo := m.index.ByteOrder()
+		for i := 0; i < len(raw); i += 16 {
+			img := &MPImage{
+				Attribute:  bo.Uint32(raw[i:]),
+				Size:       int64(bo.Uint32(raw[i+4:])),
+				Offset:     int64(bo.Uint32(raw[i+8:])),
+				Dependent1: bo.Uint16(raw[i+12:]),
+				Dependent2: bo.Uint16(raw[i+14:]),
+			}
+			if img.Offset == 0 {
+				img.FileOffset = 0
+			} else {
+				img.FileOffset = m.offsetBase + img.Offset
+			}
+			m.Images = append(m.Images, img)
+		}
+		attr = 1
+	}
+	if attr < len(m.index.IFDs) {
+		m.Attributes = m.index.IFDs[attr]
+	}
+
+	return nil
+}
+
+// String makes MPF satisfy the Stringer interface.
+func (m *MPF) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("  MPF version: %s\n", m.Version))
+	for i, img := range m.Images {
+		buf.WriteString(fmt.Sprintf("  MP image %d: %s, attr=%08x, %d[bytes], offset=%08x (file: %08x)\n",
+			i, img.TypeName(), img.Attribute, img.Size, img.Offset, img.FileOffset))
+	}
+	if len(m.Attributes) > 0 {
+		buf.WriteString("    ========= MP Attribute IFD\n")
+		for _, entry := range m.Attributes {
+			buf.WriteString(entry.String())
+			buf.WriteString("    ----\n")
+		}
+	}
+	return buf.String()
+}
+
+// MPF returns the MPF data of the file, or nil if the file has no MPF.
+func (f *File) MPF() *MPF {
+	for _, seg := range f.Segments {
+		if app2, ok := seg.parsedData.(*APP2Data); ok && app2.mpf != nil {
+			return app2.mpf
+		}
+	}
+	return nil
+}
+
+// MPImages returns the individual images of the MPF.
+// The MP Attribute IFD of each image is loaded from its own APP2.
+func (f *File) MPImages() ([]*MPImage, error) {
+	mpf := f.MPF()
+	if mpf == nil {
+		return nil, errors.New("no MPF")
+	}
+
+	for i, img := range mpf.Images {
+		if img.FileOffset == 0 {
+			img.Attributes = mpf.Attributes
+			continue
+		}
+		if img.FileOffset+img.Size > f.Size() {
+			return nil, fmt.Errorf("MP image %d is out of the file", i)
+		}
+		if !img.IsJPEG() {
+			continue
+		}
+
+		sub, err := NewFile(f.Section(img.FileOffset, img.Size))
+		if err != nil {
+			return nil, err
+		}
+		if err := sub.Parse(); err != nil {
+			return nil, fmt.Errorf("MP image %d: %w", i, err)
+		}
+		if subMPF := sub.MPF(); subMPF != nil {
+			img.Attributes = subMPF.Attributes
+		}
+	}
+
+	return mpf.Images, nil
+}
+
+// relocate updates the MP Entry in the APP2 payload (including the
+// identifier) for the new layout of the file: the MP Header at offsetBase,
+// the primary image of primarySize and the individual images moved by
+// delta.
+func (m *MPF) relocate(payload []byte, offsetBase, primarySize, delta int64) error {
+	e := m.index.Entry(0, MPEntry)
+	if e == nil {
+		// no MP Index IFD
+		return nil
+	}
+
+	bo := m.index.ByteOrder()
+	pos := int64(len("MPF\x00")) + int64(e.Offset)
+	if pos+16*int64(len(m.Images)) > int64(len(payload)) {
+		return errors.New("invalid offset of MP Entry")
+	}
+	for i, img := range m.Images {
+		entry := payload[pos+16*int64(i):]
+		if img.FileOffset == 0 {
+			bo.PutUint32(entry[4:], uint32(primarySize))
+			continue
+		}
+		offset := img.FileOffset + delta - offsetBase
+		if offset <= 0 || offset > 0xffffffff {
+			return fmt.Errorf("MP image %d is out of the file", i)
+		}
+		bo.PutUint32(entry[8:], uint32(offset))
+	}
+	return nil
+}
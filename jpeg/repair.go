@@ -0,0 +1,228 @@
+package jpeg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Fix is a fix applied by Repair.
+type Fix struct {
+	Offset      int64
+	Description string
+}
+
+// String makes Fix satisfy the Stringer interface.
+func (x *Fix) String() string {
+	return fmt.Sprintf("%08x: %s", x.Offset, x.Description)
+}
+
+// isSegmentMarker reports that the marker starts a marker segment with
+// the length, i.e. not SOI, EOI, RSTn, TEM and the fill bytes.
+func isSegmentMarker(m byte) bool {
+	return 0xc0 <= m && m <= 0xfe && (m < 0xd0 || m > 0xd9)
+}
+
+// Repair parses the truncated or damaged file as far as possible, and
+// writes the decodable image to w. It returns the fixes applied:
+//   - skips the garbage between the marker segments
+//   - clamps the length of the segment overrunning the file, and drops the
+//     APPn and COM segments which can't be parsed
+//   - drops the truncated marker segment between the scans
+//   - appends the missing EOI
+//   - drops the incomplete trailing scans of the progressive image, or
+//     re-encodes the incomplete image filling the missing blocks with gray
+//
+// The segments of f are replaced by the ones of the lenient parsing.
+func (f *File) Repair(w io.Writer) ([]*Fix, error) {
+	fixes, err := f.parseLeniently()
+	if err != nil {
+		return fixes, err
+	}
+	fix := func(offset int64, format string, a ...interface{}) {
+		fixes = append(fixes, &Fix{offset, fmt.Sprintf(format, a...)})
+	}
+
+	c, scans, err := f.decodeCoefficients(true)
+	if err != nil {
+		return fixes, err
+	}
+	if len(scans) == 0 {
+		return fixes, errors.New("no scan")
+	}
+	var data *Segment
+	for _, seg := range f.Segments {
+		if seg.Marker == Data {
+			data = seg
+		}
+	}
+
+	last := scans[len(scans)-1]
+	switch {
+	case last.complete:
+	case c.Marker == SOF2 && len(scans) > 1:
+		// the preceding scans are decodable
+		fix(data.payloadFileOffset+int64(last.start), "dropped the incomplete scan %d and the following data", len(scans)-1)
+		data.Length = int64(last.start)
+		data.reader = io.NewSectionReader(f.reader, data.payloadFileOffset, data.Length)
+		if err := data.Parse(); err != nil {
+			return fixes, err
+		}
+	default:
+		offset := data.payloadFileOffset
+		if last.start >= 0 {
+			offset += int64(last.start)
+		}
+		fix(offset, "re-encoded the incomplete scan %d filling the missing blocks", len(scans)-1)
+		coded, err := c.encode()
+		if err != nil {
+			return fixes, err
+		}
+		return fixes, f.writeCoded(w, coded, nil)
+	}
+
+	for _, seg := range f.Segments {
+		if _, err := seg.WriteTo(w); err != nil {
+			return fixes, err
+		}
+	}
+	return fixes, nil
+}
+
+// parseLeniently parses the segments of the file fixing the damage.
+func (f *File) parseLeniently() ([]*Fix, error) {
+	var fixes []*Fix
+	fix := func(offset int64, format string, a ...interface{}) {
+		fixes = append(fixes, &Fix{offset, fmt.Sprintf(format, a...)})
+	}
+
+	size := f.reader.Size()
+	b := make([]byte, size)
+	if _, err := f.reader.ReadAt(b, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if size < 2 || b[0] != 0xff || b[1] != 0xd8 {
+		return nil, errors.New("expected SOI")
+	}
+
+	newSegment := func(marker uint16, offset, length int64) *Segment {
+		return &Segment{marker, length, offset, io.NewSectionReader(f.reader, offset, length), nil}
+	}
+	// appendSegment appends the parsed segment.
+	appendSegment := func(marker uint16, offset, length int64) error {
+		seg := newSegment(marker, offset, length)
+		if err := seg.Parse(); err != nil {
+			return err
+		}
+		f.Segments = append(f.Segments, seg)
+		return nil
+	}
+	f.Segments = nil
+	if err := appendSegment(SOI, 2, 0); err != nil {
+		return nil, err
+	}
+	// nextMarker returns the offset of the next marker segment from pos.
+	nextMarker := func(pos int64) int64 {
+		for ; pos+1 < size; pos++ {
+			if b[pos] == 0xff && isSegmentMarker(b[pos+1]) {
+				return pos
+			}
+		}
+		return -1
+	}
+
+	// marker segments up to SOS
+	pos := int64(2)
+	for {
+		for pos+1 < size && b[pos] == 0xff && b[pos+1] == 0xff {
+			// fill bytes
+			pos++
+		}
+		if pos+1 >= size {
+			return fixes, errors.New("no scan")
+		}
+		if b[pos] != 0xff || !isSegmentMarker(b[pos+1]) {
+			next := nextMarker(pos)
+			if next < 0 {
+				return fixes, errors.New("no scan")
+			}
+			fix(pos, "skipped %d bytes of garbage", next-pos)
+			pos = next
+		}
+
+		marker := binary.BigEndian.Uint16(b[pos:])
+		if pos+4 > size {
+			return fixes, errors.New("no scan")
+		}
+		length := int64(binary.BigEndian.Uint16(b[pos+2:]))
+		if length < 2 {
+			fix(pos, "skipped %s of invalid length %d", (&Segment{Marker: marker}).Name(), length)
+			pos += 2
+			continue
+		}
+		if pos+2+length > size {
+			fix(pos, "clamped the length of %s from %d to %d", (&Segment{Marker: marker}).Name(), length, size-pos-2)
+			length = size - pos - 2
+		}
+
+		seg := newSegment(marker, pos+4, length-2)
+		if err := seg.Parse(); err != nil {
+			if !seg.IsAPPn() && marker != COM {
+				return fixes, err
+			}
+			fix(pos, "dropped %s which can't be parsed: %v", seg.Name(), err)
+		} else {
+			f.Segments = append(f.Segments, seg)
+		}
+		pos += 2 + length
+
+		if marker == SOS {
+			break
+		}
+	}
+
+	// entropy-coded data and the marker segments between scans up to EOI
+	start, end, eoi := pos, size, false
+	for pos+1 < size {
+		if b[pos] != 0xff {
+			pos++
+			continue
+		}
+		m := b[pos+1]
+		if m == 0xd9 {
+			end, eoi = pos, true
+			break
+		}
+		if !isSegmentMarker(m) {
+			// stuffed zero, RSTn and the fill bytes
+			pos++
+			continue
+		}
+		if pos+4 > size || pos+2+int64(binary.BigEndian.Uint16(b[pos+2:])) > size {
+			fix(pos, "dropped the truncated %s", (&Segment{Marker: binary.BigEndian.Uint16(b[pos:])}).Name())
+			end = pos
+			break
+		}
+		pos += 2 + int64(binary.BigEndian.Uint16(b[pos+2:]))
+	}
+	if end <= start {
+		return fixes, errors.New("no entropy-coded data")
+	}
+	if err := appendSegment(Data, start, end-start); err != nil {
+		return fixes, err
+	}
+
+	// EOI and the trailer
+	if !eoi {
+		fix(end, "appended the missing EOI")
+		return fixes, appendSegment(EOI, size, 0)
+	}
+	if err := appendSegment(EOI, end+2, 0); err != nil {
+		return fixes, err
+	}
+	if end+2 < size {
+		return fixes, appendSegment(Trailer, end+2, size-end-2)
+	}
+	return fixes, nil
+}
@@ -5,6 +5,9 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	stdjpeg "image/jpeg"
 	"io"
 
 	"github.com/ysh86/lspic/tiff"
@@ -14,18 +17,30 @@ import (
 const (
 	Unknown uint16 = 0
 
-	SOI  uint16 = 0xffd8 // Start of Image
-	APP0 uint16 = 0xffe0 // Application Segment 0 (JFIF)
-	APP1 uint16 = 0xffe1 // Application Segment 1 (Exif)
-	APP2 uint16 = 0xffe2 // Application Segment 2 (Flashpix)
-	COM  uint16 = 0xfffe // Comment
-	DQT  uint16 = 0xffdb // Define Quantization Table
-	DHT  uint16 = 0xffc4 // Define Huffman Table
-	DRI  uint16 = 0xffdd // Define Restart Interval
-	SOF  uint16 = 0xffc0 // Start of Frame (Baseline DCT)
-	SOS  uint16 = 0xffda // Start of Scan
-	Data uint16 = 1
-	EOI  uint16 = 0xffd9 // End of Image
+	SOI     uint16 = 0xffd8 // Start of Image
+	APP0    uint16 = 0xffe0 // Application Segment 0 (JFIF)
+	APP1    uint16 = 0xffe1 // Application Segment 1 (Exif)
+	APP2    uint16 = 0xffe2 // Application Segment 2 (Flashpix)
+	APP11   uint16 = 0xffeb // Application Segment 11 (JUMBF)
+	APP13   uint16 = 0xffed // Application Segment 13 (Photoshop)
+	APP14   uint16 = 0xffee // Application Segment 14 (Adobe)
+	COM     uint16 = 0xfffe // Comment
+	DQT     uint16 = 0xffdb // Define Quantization Table
+	DHT     uint16 = 0xffc4 // Define Huffman Table
+	DRI     uint16 = 0xffdd // Define Restart Interval
+	DNL     uint16 = 0xffdc // Define Number of Lines
+	EXP     uint16 = 0xffdf // Expand Reference Components
+	SOF     uint16 = 0xffc0 // Start of Frame (Baseline DCT)
+	SOF1    uint16 = 0xffc1 // Start of Frame (Extended sequential DCT)
+	SOF2    uint16 = 0xffc2 // Start of Frame (Progressive DCT)
+	SOF3    uint16 = 0xffc3 // Start of Frame (Lossless)
+	SOF9    uint16 = 0xffc9 // Start of Frame (Extended sequential DCT, arithmetic)
+	SOF10   uint16 = 0xffca // Start of Frame (Progressive DCT, arithmetic)
+	SOF11   uint16 = 0xffcb // Start of Frame (Lossless, arithmetic)
+	SOS     uint16 = 0xffda // Start of Scan
+	Data    uint16 = 1
+	Trailer uint16 = 2      // data after EOI
+	EOI     uint16 = 0xffd9 // End of Image
 )
 
 var markerSegmentName map[uint16]string
@@ -34,18 +49,30 @@ func init() {
 	markerSegmentName = map[uint16]string{
 		Unknown: "Unknown",
 
-		SOI:  "SOI ",
-		APP0: "APP0",
-		APP1: "APP1",
-		APP2: "APP2",
-		COM:  "COM ",
-		DQT:  "DQT ",
-		DHT:  "DHT ",
-		DRI:  "DRI ",
-		SOF:  "SOF ",
-		SOS:  "SOS ",
-		Data: "Data",
-		EOI:  "EOI ",
+		SOI:     "SOI ",
+		APP0:    "APP0",
+		APP1:    "APP1",
+		APP2:    "APP2",
+		APP11:   "APPB",
+		APP13:   "APPD",
+		APP14:   "APPE",
+		COM:     "COM ",
+		DQT:     "DQT ",
+		DHT:     "DHT ",
+		DRI:     "DRI ",
+		DNL:     "DNL ",
+		EXP:     "EXP ",
+		SOF:     "SOF ",
+		SOF1:    "SOF1",
+		SOF2:    "SOF2",
+		SOF3:    "SOF3",
+		SOF9:    "SOF9",
+		SOF10:   "SOFa",
+		SOF11:   "SOFb",
+		SOS:     "SOS ",
+		Data:    "Data",
+		Trailer: "Trlr",
+		EOI:     "EOI ",
 	}
 }
 
@@ -67,6 +94,26 @@ func (s *Segment) Parse() error {
 		s.parsedData = &APP1Data{}
 	case APP0:
 		s.parsedData = &APP0Data{}
+	case APP2:
+		s.parsedData = &APP2Data{}
+	case APP11:
+		s.parsedData = &APP11Data{}
+	case APP13:
+		s.parsedData = &APP13Data{}
+	case APP14:
+		s.parsedData = &APP14Data{}
+	case SOF, SOF1, SOF2, SOF3, SOF9, SOF10, SOF11:
+		s.parsedData = &SOFData{}
+	case COM:
+		s.parsedData = &COMData{}
+	case DRI:
+		s.parsedData = &DRIData{}
+	case DNL:
+		s.parsedData = &DNLData{}
+	case EXP:
+		s.parsedData = &EXPData{}
+	case Data:
+		s.parsedData = &EntropyCodedData{}
 	default:
 		s.parsedData = &SegmentData{}
 	}
@@ -176,7 +223,7 @@ func (d *APP1Data) Parse(segment *Segment) error {
 
 		d.identifier = string(longIdent)
 
-		if d.identifier == "http://ns.adobe.com/xap/1.0/" {
+		if d.identifier == xmpIdentifier {
 			payload, err := io.ReadAll(sr)
 			if err != nil {
 				return err
@@ -185,7 +232,7 @@ func (d *APP1Data) Parse(segment *Segment) error {
 			return nil
 		}
 
-		if d.identifier == "http://ns.adobe.com/xmp/extension/" {
+		if d.identifier == extendedXMPIdentifier {
 			// GUID
 			_, err := sr.Read(d.md5Digest[:])
 			if err != nil {
@@ -253,7 +300,32 @@ func (d *APP1Data) SplitTo(w io.Writer, r io.ReadSeeker, offset, length int64) (
 	return 0, nil
 }
 
-// APP0Data is the Application Segment 0 (JFIF)
+// exif returns the APP1 data of Exif, or nil if the file has no Exif.
+func (f *File) exif() *APP1Data {
+	for _, seg := range f.Segments {
+		if app1, ok := seg.parsedData.(*APP1Data); ok && app1.exif != nil {
+			return app1
+		}
+	}
+	return nil
+}
+
+// Exif returns the TIFF stream of Exif, or nil if the file has no Exif.
+func (f *File) Exif() *tiff.File {
+	if app1 := f.exif(); app1 != nil {
+		return app1.exif
+	}
+	return nil
+}
+
+// JFXX extension code
+const (
+	ThumbnailJPEG    uint8 = 0x10
+	ThumbnailPalette uint8 = 0x11
+	ThumbnailRGB     uint8 = 0x13
+)
+
+// APP0Data is the Application Segment 0 (JFIF, JFXX)
 type APP0Data struct {
 	identifier string
 	version    uint16
@@ -262,6 +334,15 @@ type APP0Data struct {
 	yDensity   uint16
 	xThumbnail uint8
 	yThumbnail uint8
+
+	// JFXX
+	extensionCode uint8
+
+	thumbnail []byte // RGB, palette indices or JPEG
+	palette   []byte
+
+	// truncated thumbnail, which is dropped
+	err error
 }
 
 // Parse parses APP0 data.
@@ -272,6 +353,10 @@ func (d *APP0Data) Parse(segment *Segment) error {
 	if _, err := r.Read(ident[:]); err != nil {
 		return err
 	}
+	if bytes.Equal(ident[:], []byte{'J', 'F', 'X', 'X', 0}) {
+		d.identifier = string(ident[0:4])
+		return d.parseJFXX(r, segment.Length-int64(len(ident)))
+	}
 	if !bytes.Equal(ident[:], []byte{'J', 'F', 'I', 'F', 0}) {
 		return errors.New("invalid ident of APP0")
 	}
@@ -298,25 +383,336 @@ func (d *APP0Data) Parse(segment *Segment) error {
 		return err
 	}
 
-	// TODO: Thumbnail (RGB xN)
+	// Thumbnail (RGB xN)
+	if n := 3 * int(d.xThumbnail) * int(d.yThumbnail); n > 0 {
+		d.extensionCode = ThumbnailRGB
+		d.thumbnail = make([]byte, n)
+		if _, err := io.ReadFull(r, d.thumbnail); err != nil {
+			d.dropThumbnail(err)
+		}
+	}
 
 	return nil
 }
 
+// dropThumbnail drops the truncated thumbnail not to make the image
+// unreadable.
+func (d *APP0Data) dropThumbnail(err error) {
+	d.thumbnail = nil
+	d.palette = nil
+	d.err = fmt.Errorf("truncated thumbnail: %v", err)
+}
+
+func (d *APP0Data) parseJFXX(r io.Reader, length int64) error {
+	if err := binary.Read(r, binary.BigEndian, &d.extensionCode); err != nil {
+		return err
+	}
+
+	switch d.extensionCode {
+	case ThumbnailJPEG:
+		var err error
+		d.thumbnail, err = io.ReadAll(io.LimitReader(r, length-1))
+		return err
+	case ThumbnailPalette, ThumbnailRGB:
+		if err := binary.Read(r, binary.BigEndian, &d.xThumbnail); err != nil {
+			return err
+		}
+		if err := binary.Read(r, binary.BigEndian, &d.yThumbnail); err != nil {
+			return err
+		}
+		n := int(d.xThumbnail) * int(d.yThumbnail)
+		if d.extensionCode == ThumbnailPalette {
+			d.palette = make([]byte, 3*256)
+			if _, err := io.ReadFull(r, d.palette); err != nil {
+				d.dropThumbnail(err)
+				return nil
+			}
+		} else {
+			n *= 3
+		}
+		d.thumbnail = make([]byte, n)
+		if _, err := io.ReadFull(r, d.thumbnail); err != nil {
+			d.dropThumbnail(err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("invalid extension code of JFXX: %02x", d.extensionCode)
+}
+
 // String makes APP0Data satisfy the Stringer interface.
 func (d *APP0Data) String() string {
 	var buf bytes.Buffer
 
 	buf.WriteString(fmt.Sprintf("  identifier: %s\n", d.identifier))
-	buf.WriteString(fmt.Sprintf("  version: %04x\n", d.version))
-	buf.WriteString(fmt.Sprintf("  units: %d\n", d.units))
-	buf.WriteString(fmt.Sprintf("  Density WxH: %dx%d\n", d.xDensity, d.yDensity))
-	buf.WriteString(fmt.Sprintf("  Thumbnail WxH: %dx%d\n", d.xThumbnail, d.yThumbnail))
+	if d.identifier == "JFIF" {
+		buf.WriteString(fmt.Sprintf("  version: %04x\n", d.version))
+		buf.WriteString(fmt.Sprintf("  units: %d\n", d.units))
+		buf.WriteString(fmt.Sprintf("  Density WxH: %dx%d\n", d.xDensity, d.yDensity))
+	} else {
+		buf.WriteString(fmt.Sprintf("  extension code: %02x\n", d.extensionCode))
+	}
+	if d.extensionCode == ThumbnailJPEG {
+		buf.WriteString(fmt.Sprintf("  Thumbnail JPEG: %d[bytes]\n", len(d.thumbnail)))
+	} else {
+		buf.WriteString(fmt.Sprintf("  Thumbnail WxH: %dx%d\n", d.xThumbnail, d.yThumbnail))
+	}
+	if d.err != nil {
+		buf.WriteString(fmt.Sprintf("  invalid: %v\n", d.err))
+	}
+
+	return buf.String()
+}
+
+// HasThumbnail returns that the segment has a thumbnail or not.
+func (d *APP0Data) HasThumbnail() bool {
+	return len(d.thumbnail) > 0
+}
+
+// ThumbnailJPEG returns the JPEG data of the JFXX thumbnail coded using JPEG.
+func (d *APP0Data) ThumbnailJPEG() ([]byte, bool) {
+	if d.extensionCode != ThumbnailJPEG || len(d.thumbnail) == 0 {
+		return nil, false
+	}
+	return d.thumbnail, true
+}
+
+// Thumbnail decodes the thumbnail.
+func (d *APP0Data) Thumbnail() (image.Image, error) {
+	if !d.HasThumbnail() {
+		return nil, errors.New("no thumbnail")
+	}
+
+	rect := image.Rect(0, 0, int(d.xThumbnail), int(d.yThumbnail))
+	switch d.extensionCode {
+	case ThumbnailJPEG:
+		return stdjpeg.Decode(bytes.NewReader(d.thumbnail))
+	case ThumbnailPalette:
+		palette := make(color.Palette, 256)
+		for i := range palette {
+			palette[i] = color.RGBA{d.palette[3*i], d.palette[3*i+1], d.palette[3*i+2], 0xff}
+		}
+		img := image.NewPaletted(rect, palette)
+		copy(img.Pix, d.thumbnail)
+		return img, nil
+	case ThumbnailRGB:
+		img := image.NewRGBA(rect)
+		for i := 0; i < len(d.thumbnail)/3; i++ {
+			img.Pix[4*i+0] = d.thumbnail[3*i+0]
+			img.Pix[4*i+1] = d.thumbnail[3*i+1]
+			img.Pix[4*i+2] = d.thumbnail[3*i+2]
+			img.Pix[4*i+3] = 0xff
+		}
+		return img, nil
+	}
+
+	return nil, fmt.Errorf("invalid extension code of JFXX: %02x", d.extensionCode)
+}
+
+// JFIF returns the JFIF and JFXX APP0 data of the file.
+func (f *File) JFIF() []*APP0Data {
+	var app0s []*APP0Data
+	for _, seg := range f.Segments {
+		if app0, ok := seg.parsedData.(*APP0Data); ok {
+			app0s = append(app0s, app0)
+		}
+	}
+	return app0s
+}
+
+// APP2Data is the Application Segment 2 (Flashpix, ICC profile, MPF)
+type APP2Data struct {
+	SegmentData
+
+	identifier string
+
+	// MPF
+	mpf *MPF
+
+	// ISO 21496-1 gain map metadata
+	gainMap []byte
+
+	// ICC profile chunk
+	iccSeq   uint8
+	iccCount uint8
+	icc      []byte
+
+	err error
+}
+
+const (
+	isoGainMapIdentifier = "urn:iso:std:iso:ts:21496:-1"
+	iccIdentifier        = "ICC_PROFILE"
+)
+
+// Parse parses APP2 data. The malformed segment is kept unparsed with the
+// error not to make the image unreadable.
+func (d *APP2Data) Parse(segment *Segment) error {
+	d.err = d.parse(segment)
+	return nil
+}
+
+func (d *APP2Data) parse(segment *Segment) error {
+	sr := segment.reader
+
+	ident := make([]byte, 0, 32)
+	for {
+		var b byte
+		err := binary.Read(sr, binary.BigEndian, &b)
+		if err != nil || b == 0 {
+			break
+		}
+		ident = append(ident, b)
+	}
+	d.identifier = string(ident)
+
+	if d.identifier == "MPF" {
+		offset := int64(len(ident) + 1)
+		length := segment.Length - offset
+		mpf := &MPF{}
+		if err := mpf.parse(io.NewSectionReader(sr, offset, length), segment.payloadFileOffset+offset); err != nil {
+			return err
+		}
+		d.mpf = mpf
+		return nil
+	}
+	if d.identifier == isoGainMapIdentifier {
+		var err error
+		d.gainMap, err = io.ReadAll(sr)
+		return err
+	}
+	if d.identifier == iccIdentifier {
+		if err := binary.Read(sr, binary.BigEndian, &d.iccSeq); err != nil {
+			return err
+		}
+		if err := binary.Read(sr, binary.BigEndian, &d.iccCount); err != nil {
+			return err
+		}
+		var err error
+		d.icc, err = io.ReadAll(sr)
+		return err
+	}
+
+	// others are not supported yet
+	return nil
+}
+
+// String makes APP2Data satisfy the Stringer interface.
+func (d *APP2Data) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("  identifier: %s\n", d.identifier))
+	if d.err != nil {
+		buf.WriteString(fmt.Sprintf("  invalid: %v\n", d.err))
+		return buf.String()
+	}
+
+	// MPF
+	if d.mpf != nil {
+		buf.WriteString(d.mpf.String())
+	}
+	if d.identifier == isoGainMapIdentifier {
+		buf.WriteString(fmt.Sprintf("  gain map metadata: %d[bytes]\n", len(d.gainMap)))
+	}
+	if d.identifier == iccIdentifier {
+		buf.WriteString(fmt.Sprintf("  ICC profile: %d/%d, %d[bytes]\n", d.iccSeq, d.iccCount, len(d.icc)))
+	}
+
+	return buf.String()
+}
+
+// GainMapMetadata returns the ISO 21496-1 gain map metadata in APP2, or
+// nil if the file has none. The primary image has only the version, and
+// the gain map image has the whole metadata.
+func (f *File) GainMapMetadata() []byte {
+	for _, seg := range f.Segments {
+		if app2, ok := seg.parsedData.(*APP2Data); ok && app2.identifier == isoGainMapIdentifier && app2.err == nil {
+			return app2.gainMap
+		}
+	}
+	return nil
+}
+
+// Component is a component of the frame.
+type Component struct {
+	ID uint8
+	H  uint8 // horizontal sampling factor
+	V  uint8 // vertical sampling factor
+	Tq uint8 // quantization table selector
+}
+
+// SOFData is the Start of Frame
+type SOFData struct {
+	SegmentData
+
+	Precision  uint8
+	Height     uint16
+	Width      uint16
+	Components []Component
+
+	err error
+}
+
+// Parse parses SOF data. The invalid segment is kept unparsed with the
+// error.
+func (d *SOFData) Parse(segment *Segment) error {
+	d.err = d.parse(segment.reader)
+	return nil
+}
+
+func (d *SOFData) parse(r io.Reader) error {
+	if err := binary.Read(r, binary.BigEndian, &d.Precision); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.BigEndian, &d.Height); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.BigEndian, &d.Width); err != nil {
+		return err
+	}
+
+	var num uint8
+	if err := binary.Read(r, binary.BigEndian, &num); err != nil {
+		return err
+	}
+	d.Components = make([]Component, num)
+	for i := range d.Components {
+		var buf [3]byte
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return err
+		}
+		d.Components[i] = Component{
+			ID: buf[0],
+			H:  buf[1] >> 4,
+			V:  buf[1] & 0xf,
+			Tq: buf[2],
+		}
+		if d.Components[i].H == 0 || d.Components[i].V == 0 {
+			return errors.New("invalid sampling factor")
+		}
+	}
+
+	return nil
+}
+
+// String makes SOFData satisfy the Stringer interface.
+func (d *SOFData) String() string {
+	if d.err != nil {
+		return fmt.Sprintf("  invalid: %v\n", d.err)
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteString(fmt.Sprintf("  precision: %d\n", d.Precision))
+	buf.WriteString(fmt.Sprintf("  WxH: %dx%d\n", d.Width, d.Height))
+	for _, c := range d.Components {
+		buf.WriteString(fmt.Sprintf("  component %d: HxV=%dx%d, Tq=%d\n", c.ID, c.H, c.V, c.Tq))
+	}
 
 	return buf.String()
 }
 
-// SegmentData is a dummy(unknown) segment
+// SegmentData is a dummy(unknown) segment. It is embedded in the parsers
+// to split the raw data.
 type SegmentData struct {
 	// dummy
 }
@@ -0,0 +1,181 @@
+package jpeg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/ysh86/lspic/tiff"
+)
+
+// 65535 - 2 (length)
+const maxSegmentPayloadSize = 65533
+
+// Identifier returns the identifier of the APPn segment, e.g. "JFIF",
+// "Exif", "ICC_PROFILE" and the namespace of XMP. It returns "" for the
+// other segments.
+func (s *Segment) Identifier() string {
+	switch d := s.parsedData.(type) {
+	case *APP0Data:
+		return d.identifier
+	case *APP1Data:
+		return d.identifier
+	case *APP2Data:
+		return d.identifier
+	case *APP11Data:
+		return d.identifier
+	case *APP13Data:
+		return d.identifier
+	case *APP14Data:
+		return d.identifier
+	}
+	return ""
+}
+
+// IsAPPn returns that the segment is an application segment or not.
+func (s *Segment) IsAPPn() bool {
+	return APP0 <= s.Marker && s.Marker <= 0xffef
+}
+
+// WriteTo writes the raw bytes of the segment including the marker and
+// the length to w.
+func (s *Segment) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	switch s.Marker {
+	case Data, Trailer:
+		// no marker
+	case SOI, EOI:
+		if err := binary.Write(w, binary.BigEndian, s.Marker); err != nil {
+			return n, err
+		}
+		n += 2
+	default:
+		if err := binary.Write(w, binary.BigEndian, [2]uint16{s.Marker, uint16(s.Length + 2)}); err != nil {
+			return n, err
+		}
+		n += 4
+	}
+
+	m, err := io.Copy(w, io.NewSectionReader(s.reader, 0, s.Length))
+	return n + m, err
+}
+
+func writeSegment(w io.Writer, marker uint16, payload []byte) error {
+	if len(payload) > maxSegmentPayloadSize {
+		return fmt.Errorf("too large segment %04x: %d[bytes]", marker, len(payload))
+	}
+	if err := binary.Write(w, binary.BigEndian, [2]uint16{marker, uint16(len(payload) + 2)}); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// StripOptions specifies the metadata kept by Strip.
+type StripOptions struct {
+	// Keep reports whether the APPn or COM segment is kept.
+	Keep func(s *Segment) bool
+
+	// ExifTags is the allow-list of the tags in the 0th IFD and its
+	// sub-IFDs (Exif, GPS, Interoperability). nil keeps the Exif as is.
+	ExifTags map[uint16]bool
+	// ExifThumbnail keeps the 1st IFD (thumbnail) of the rewritten Exif.
+	ExifThumbnail bool
+
+	// Trailer keeps the data after EOI (e.g. MPF images, Motion Photo).
+	Trailer bool
+}
+
+// DefaultStripOptions returns the options which keep only JFIF, the ICC
+// profile, Adobe (the color transform) and the orientation of Exif.
+func DefaultStripOptions() *StripOptions {
+	return &StripOptions{
+		Keep: func(s *Segment) bool {
+			switch s.Identifier() {
+			case "JFIF":
+				return s.Marker == APP0
+			case "Exif":
+				return s.Marker == APP1
+			case iccIdentifier:
+				return s.Marker == APP2
+			case "Adobe":
+				return s.Marker == APP14
+			}
+			return false
+		},
+		ExifTags: map[uint16]bool{
+			tiff.Orientation: true,
+		},
+	}
+}
+
+// Strip writes the file without the APPn and COM segments which are not
+// kept by opts. The other segments (SOF, DQT, DHT, DRI, SOS, ...) and the
+// entropy-coded data are written byte-identical, and the MP Entry of the
+// kept MPF is updated for the new layout. MPF is removed with the trailer
+// which has the MP images. nil opts (or nil Keep) is DefaultStripOptions.
+func (f *File) Strip(w io.Writer, opts *StripOptions) error {
+	if opts == nil {
+		opts = DefaultStripOptions()
+	}
+	keep := opts.Keep
+	if keep == nil {
+		keep = DefaultStripOptions().Keep
+	}
+
+	var parts []*part
+	for _, seg := range f.Segments {
+		switch {
+		case seg.IsAPPn() || seg.Marker == COM:
+			if !keep(seg) {
+				continue
+			}
+			if seg.Marker == APP2 && seg.Identifier() == "MPF" && !opts.Trailer {
+				continue
+			}
+			if app1, ok := seg.parsedData.(*APP1Data); ok && app1.exif != nil && opts.ExifTags != nil {
+				payload, err := app1.stripExif(opts.ExifTags, opts.ExifThumbnail)
+				if err != nil {
+					return err
+				}
+				if payload == nil {
+					// no tags left
+					continue
+				}
+				parts = append(parts, &part{marker: APP1, payload: payload})
+				continue
+			}
+		case seg.Marker == Trailer:
+			if !opts.Trailer {
+				continue
+			}
+		}
+
+		parts = append(parts, &part{seg: seg})
+	}
+	return f.writeParts(w, parts)
+}
+
+// stripExif returns the APP1 payload of the Exif only with the tags, or
+// nil if no tags are left.
+func (d *APP1Data) stripExif(tags map[uint16]bool, thumbnail bool) ([]byte, error) {
+	dir, err := d.exif.Directory()
+	if err != nil {
+		return nil, fmt.Errorf("Exif: %w", err)
+	}
+	dir.Keep(func(tag uint16) bool {
+		return tags[tag]
+	})
+	if !thumbnail {
+		dir.Next = nil
+	}
+	if len(dir.Fields) == 0 && len(dir.SubIFDs) == 0 && dir.Next == nil {
+		return nil, nil
+	}
+
+	b, err := tiff.Encode(dir, d.exif.ByteOrder())
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("Exif\x00\x00"), b...), nil
+}
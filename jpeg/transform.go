@@ -0,0 +1,338 @@
+package jpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ysh86/lspic/tiff"
+)
+
+// Transform is a lossless transformation of the image.
+type Transform int
+
+// Transform
+const (
+	TransformNone Transform = iota
+	FlipHorizontal
+	FlipVertical
+	Transpose  // across the upper-left to lower-right axis
+	Transverse // across the upper-right to lower-left axis
+	Rotate90   // clockwise
+	Rotate180
+	Rotate270
+)
+
+var transformName = map[Transform]string{
+	TransformNone:  "none",
+	FlipHorizontal: "flip-h",
+	FlipVertical:   "flip-v",
+	Transpose:      "transpose",
+	Transverse:     "transverse",
+	Rotate90:       "rot90",
+	Rotate180:      "rot180",
+	Rotate270:      "rot270",
+}
+
+// String makes Transform satisfy the Stringer interface.
+func (t Transform) String() string {
+	if name, ok := transformName[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("Transform(%d)", int(t))
+}
+
+// transposed reports whether the transform swaps the width and the height.
+func (t Transform) transposed() bool {
+	return t == Transpose || t == Transverse || t == Rotate90 || t == Rotate270
+}
+
+// TransformForOrientation returns the transform which makes the image of
+// the Exif orientation upright.
+func TransformForOrientation(orientation int) Transform {
+	switch orientation {
+	case 2:
+		return FlipHorizontal
+	case 3:
+		return Rotate180
+	case 4:
+		return FlipVertical
+	case 5:
+		return Transpose
+	case 6:
+		return Rotate90
+	case 7:
+		return Transverse
+	case 8:
+		return Rotate270
+	}
+	return TransformNone
+}
+
+// Orientation returns the orientation of Exif, or 1 if the file has no
+// orientation.
+func (f *File) Orientation() int {
+	app1 := f.exif()
+	if app1 == nil {
+		return 1
+	}
+	dir, err := app1.exif.Directory()
+	if err != nil {
+		return 1
+	}
+	field := dir.Field(tiff.Orientation)
+	if field == nil || field.Type != tiff.SHORT || len(field.Value) < 2 {
+		return 1
+	}
+	return int(app1.exif.ByteOrder().Uint16(field.Value))
+}
+
+// Transform writes the file transformed losslessly to w. The DCT
+// coefficients are rearranged without the requantization, and the partial
+// MCUs at the edges moved to the top or the left are trimmed as
+// "jpegtran -trim" does. The Exif orientation is reset to 1 and the Exif
+// thumbnail is transformed too. The orientation of XMP and the MPF images
+// in the trailer are left as is.
+//
+// The progressive image is written in the sequential mode.
+func (f *File) Transform(w io.Writer, t Transform) error {
+	if len(f.Segments) == 0 || f.Segments[0].Marker != SOI {
+		return errors.New("expected SOI")
+	}
+
+	src, err := f.Coefficients()
+	if err != nil {
+		return err
+	}
+	dst := src.transform(t)
+	coded, err := dst.encode()
+	if err != nil {
+		return err
+	}
+
+	return f.writeCoded(w, coded, func(d *APP1Data) ([]byte, error) {
+		return d.updateExif(dst.Width, dst.Height, true, func(b []byte) []byte {
+			thumbnail, err := transformThumbnail(b, t)
+			if err != nil {
+				// drop the thumbnail which can't be transformed
+				return nil
+			}
+			return thumbnail
+		})
+	})
+}
+
+// writeCoded writes the file with the re-encoded image to w. The APPn and
+// COM segments are kept in the original order with the Exif rewritten by
+// exif (as is if exif is nil), and the trailer follows EOI.
+func (f *File) writeCoded(w io.Writer, coded []*part, exif func(d *APP1Data) ([]byte, error)) error {
+	parts := []*part{{seg: f.Segments[0]}}
+	for _, seg := range f.Segments[1:] {
+		if !seg.IsAPPn() && seg.Marker != COM {
+			continue
+		}
+		if app1, ok := seg.parsedData.(*APP1Data); ok && app1.exif != nil && exif != nil {
+			payload, err := exif(app1)
+			if err != nil {
+				return err
+			}
+			parts = append(parts, &part{marker: APP1, payload: payload})
+			continue
+		}
+		parts = append(parts, &part{seg: seg})
+	}
+	parts = append(parts, coded...)
+	for _, seg := range f.Segments {
+		if seg.Marker == EOI || seg.Marker == Trailer {
+			parts = append(parts, &part{seg: seg})
+		}
+	}
+
+	return f.writeParts(w, parts)
+}
+
+// transformBlock transforms the coefficients of a block in the natural
+// order. The sign of the odd frequencies is inverted for the flip.
+func transformBlock(dst, src *Block, t Transform) {
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			var c int16
+			var flipU, flipV bool
+			switch t {
+			case FlipHorizontal:
+				c, flipU = src[v*8+u], true
+			case FlipVertical:
+				c, flipV = src[v*8+u], true
+			case Rotate180:
+				c, flipU, flipV = src[v*8+u], true, true
+			case Transpose:
+				c = src[u*8+v]
+			case Transverse:
+				c, flipU, flipV = src[u*8+v], true, true
+			case Rotate90:
+				c, flipU = src[u*8+v], true
+			case Rotate270:
+				c, flipV = src[u*8+v], true
+			default:
+				c = src[v*8+u]
+			}
+			if flipU && u%2 == 1 {
+				c = -c
+			}
+			if flipV && v%2 == 1 {
+				c = -c
+			}
+			dst[v*8+u] = c
+		}
+	}
+}
+
+// trim returns the size trimmed to the multiple of the size of the MCU,
+// or the size itself if no MCU is left.
+func trim(size, mcu int) int {
+	if trimmed := size / mcu * mcu; trimmed > 0 {
+		return trimmed
+	}
+	return size
+}
+
+// transform returns the coefficients of the transformed image.
+func (c *Coefficients) transform(t Transform) *Coefficients {
+	// the partial MCUs at the right or the bottom can't be moved
+	src := *c
+	switch t {
+	case FlipHorizontal, Rotate270:
+		src.Width = trim(c.Width, 8*c.hmax)
+	case FlipVertical, Rotate90:
+		src.Height = trim(c.Height, 8*c.vmax)
+	case Transverse, Rotate180:
+		src.Width = trim(c.Width, 8*c.hmax)
+		src.Height = trim(c.Height, 8*c.vmax)
+	}
+
+	dst := &Coefficients{
+		Marker:          c.Marker,
+		Precision:       c.Precision,
+		Width:           src.Width,
+		Height:          src.Height,
+		Quant:           c.Quant,
+		quantDefined:    c.quantDefined,
+		RestartInterval: c.RestartInterval,
+	}
+	if t.transposed() {
+		dst.Width, dst.Height = src.Height, src.Width
+		for i := range dst.Quant {
+			for v := 0; v < 8; v++ {
+				for u := 0; u < 8; u++ {
+					dst.Quant[i][v*8+u] = c.Quant[i][u*8+v]
+				}
+			}
+		}
+	}
+	for _, comp := range c.Planes {
+		fc := &Plane{Component: comp.Component}
+		if t.transposed() {
+			fc.H, fc.V = comp.V, comp.H
+		}
+		dst.Planes = append(dst.Planes, fc)
+	}
+	dst.allocate()
+
+	for i, dc := range dst.Planes {
+		sc := c.Planes[i]
+		sw, sh := src.blocksW(sc), src.blocksH(sc)
+		for dby := 0; dby < dc.BlocksH; dby++ {
+			for dbx := 0; dbx < dc.BlocksW; dbx++ {
+				var sx, sy int
+				switch t {
+				case FlipHorizontal:
+					sx, sy = sw-1-dbx, dby
+				case FlipVertical:
+					sx, sy = dbx, sh-1-dby
+				case Rotate180:
+					sx, sy = sw-1-dbx, sh-1-dby
+				case Transpose:
+					sx, sy = dby, dbx
+				case Transverse:
+					sx, sy = sw-1-dby, sh-1-dbx
+				case Rotate90:
+					sx, sy = dby, sh-1-dbx
+				case Rotate270:
+					sx, sy = sw-1-dby, dbx
+				default:
+					sx, sy = dbx, dby
+				}
+				if sx < 0 || sx >= sc.BlocksW || sy < 0 || sy >= sc.BlocksH {
+					// padding
+					continue
+				}
+				transformBlock(dc.Block(dbx, dby), sc.Block(sx, sy), t)
+			}
+		}
+	}
+
+	return dst
+}
+
+// setUint sets the value of the SHORT or LONG field.
+func setUint(field *tiff.Field, byteOrder binary.ByteOrder, v uint32) {
+	if field.Type == tiff.LONG {
+		field.Count, field.Value = 1, make([]byte, 4)
+		byteOrder.PutUint32(field.Value, v)
+		return
+	}
+	field.Type, field.Count, field.Value = tiff.SHORT, 1, make([]byte, 2)
+	byteOrder.PutUint16(field.Value, uint16(v))
+}
+
+// updateExif returns the APP1 payload of the Exif for the new image of
+// width x height. The orientation is reset to 1 if orientation is true.
+// thumbnail converts the JPEG thumbnail, or returns nil to drop it.
+func (d *APP1Data) updateExif(width, height int, orientation bool, thumbnail func(b []byte) []byte) ([]byte, error) {
+	dir, err := d.exif.Directory()
+	if err != nil {
+		return nil, fmt.Errorf("Exif: %w", err)
+	}
+	byteOrder := d.exif.ByteOrder()
+
+	if field := dir.Field(tiff.Orientation); field != nil && orientation {
+		setUint(field, byteOrder, 1)
+	}
+	if exif := dir.SubIFDs[tiff.ExifIFDPointer]; exif != nil {
+		if field := exif.Field(tiff.PixelXDimension); field != nil {
+			setUint(field, byteOrder, uint32(width))
+		}
+		if field := exif.Field(tiff.PixelYDimension); field != nil {
+			setUint(field, byteOrder, uint32(height))
+		}
+	}
+
+	if dir.Next != nil && dir.Next.Thumbnail != nil {
+		if dir.Next.Thumbnail = thumbnail(dir.Next.Thumbnail); dir.Next.Thumbnail == nil {
+			dir.Next = nil
+		}
+	}
+
+	b, err := tiff.Encode(dir, byteOrder)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("Exif\x00\x00"), b...), nil
+}
+
+func transformThumbnail(b []byte, t Transform) ([]byte, error) {
+	f, err := NewFile(io.NewSectionReader(bytes.NewReader(b), 0, int64(len(b))))
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Parse(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := f.Transform(&buf, t); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,134 @@
+package jpeg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	stdjpeg "image/jpeg"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// testJPEG encodes a gradient image of the size, which is YCbCr 4:2:0.
+func testJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 5), uint8((x + y) * 3), 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := stdjpeg.Encode(&buf, img, &stdjpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func parseJPEG(t *testing.T, b []byte) *File {
+	t.Helper()
+	f, err := NewFile(io.NewSectionReader(bytes.NewReader(b), 0, int64(len(b))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func coefficients(t *testing.T, b []byte) *Coefficients {
+	t.Helper()
+	c, err := parseJPEG(t, b).Coefficients()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestTransformRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		transforms []Transform
+	}{
+		{"flip-h twice", []Transform{FlipHorizontal, FlipHorizontal}},
+		{"flip-v twice", []Transform{FlipVertical, FlipVertical}},
+		{"transpose twice", []Transform{Transpose, Transpose}},
+		{"transverse twice", []Transform{Transverse, Transverse}},
+		{"rot180 twice", []Transform{Rotate180, Rotate180}},
+		{"rot90 and rot270", []Transform{Rotate90, Rotate270}},
+		{"rot90 four times", []Transform{Rotate90, Rotate90, Rotate90, Rotate90}},
+		{"flip-h, flip-v and rot180", []Transform{FlipHorizontal, FlipVertical, Rotate180}},
+	}
+
+	// a multiple of the MCU not to trim the edges
+	src := testJPEG(t, 64, 48)
+	want := coefficients(t, src)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := src
+			for _, tr := range tt.transforms {
+				var buf bytes.Buffer
+				if err := parseJPEG(t, b).Transform(&buf, tr); err != nil {
+					t.Fatalf("%s: %v", tr, err)
+				}
+				b = buf.Bytes()
+			}
+
+			got := coefficients(t, b)
+			if got.Width != want.Width || got.Height != want.Height {
+				t.Fatalf("size: got %dx%d, want %dx%d", got.Width, got.Height, want.Width, want.Height)
+			}
+			if got.Quant != want.Quant {
+				t.Errorf("quantization tables differ")
+			}
+			if !reflect.DeepEqual(got.Planes, want.Planes) {
+				t.Errorf("coefficients differ")
+			}
+		})
+	}
+}
+
+func TestTransformSize(t *testing.T) {
+	// the partial MCUs (16x16) on the edges are trimmed if they are moved
+	tests := []struct {
+		transform     Transform
+		srcW, srcH    int
+		width, height int
+	}{
+		// partial on both axes
+		{TransformNone, 70, 50, 70, 50},
+		{FlipHorizontal, 70, 50, 64, 50},
+		{FlipVertical, 70, 50, 70, 48},
+		{Transpose, 70, 50, 50, 70},
+		{Transverse, 70, 50, 48, 64},
+		{Rotate90, 70, 50, 48, 70},
+		{Rotate180, 70, 50, 64, 48},
+		{Rotate270, 70, 50, 50, 64},
+		// partial only on the vertical axis
+		{FlipHorizontal, 64, 50, 64, 50},
+		{FlipVertical, 64, 50, 64, 48},
+		{Transverse, 64, 50, 48, 64},
+		// partial only on the horizontal axis
+		{FlipHorizontal, 70, 48, 64, 48},
+		{FlipVertical, 70, 48, 70, 48},
+		{Transverse, 70, 48, 48, 64},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %dx%d", tt.transform, tt.srcW, tt.srcH), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := parseJPEG(t, testJPEG(t, tt.srcW, tt.srcH)).Transform(&buf, tt.transform); err != nil {
+				t.Fatal(err)
+			}
+			img, err := stdjpeg.Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := img.Bounds().Size(); got.X != tt.width || got.Y != tt.height {
+				t.Errorf("got %dx%d, want %dx%d", got.X, got.Y, tt.width, tt.height)
+			}
+		})
+	}
+}
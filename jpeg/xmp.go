@@ -0,0 +1,211 @@
+package jpeg
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// XMP namespace / APP1 identifier
+const (
+	xmpIdentifier         = "http://ns.adobe.com/xap/1.0/"
+	extendedXMPIdentifier = "http://ns.adobe.com/xmp/extension/"
+	xmpNoteNamespace      = "http://ns.adobe.com/xmp/note/"
+
+	// 65535 - 2 (length)
+	maxXMPPayloadSize = 65533
+)
+
+// XMP is the XMP of the JPEG file.
+type XMP struct {
+	// StandardXMP
+	Standard []byte
+
+	// ExtendedXMP reassembled from the chunks (nil if none)
+	Extended []byte
+	GUID     string
+}
+
+// Bytes returns the StandardXMP followed by the ExtendedXMP.
+func (x *XMP) Bytes() []byte {
+	b := make([]byte, 0, len(x.Standard)+len(x.Extended))
+	b = append(b, x.Standard...)
+	b = append(b, x.Extended...)
+	return b
+}
+
+// XMP returns the XMP of the file, or nil if the file has no XMP.
+// The ExtendedXMP chunks are grouped by the GUID declared in
+// xmpNote:HasExtendedXMP of the StandardXMP and verified by the MD5 digest.
+func (f *File) XMP() (*XMP, error) {
+	x := &XMP{}
+
+	var chunks []*APP1Data
+	for _, seg := range f.Segments {
+		app1, ok := seg.parsedData.(*APP1Data)
+		if !ok {
+			continue
+		}
+		switch app1.identifier {
+		case xmpIdentifier:
+			if x.Standard == nil {
+				x.Standard = app1.xmpPacket
+			}
+		case extendedXMPIdentifier:
+			chunks = append(chunks, app1)
+		}
+	}
+	if x.Standard == nil {
+		if len(chunks) > 0 {
+			return nil, errors.New("ExtendedXMP without StandardXMP")
+		}
+		return nil, nil
+	}
+
+	// the GUID is the MD5 digest in the uppercase hex
+	guid := strings.ToUpper(hasExtendedXMP(x.Standard))
+	if guid == "" {
+		// ExtendedXMP not referred from StandardXMP is ignored.
+		return x, nil
+	}
+
+	var err error
+	x.Extended, err = reassembleExtendedXMP(guid, chunks)
+	if err != nil {
+		return nil, err
+	}
+	x.GUID = guid
+
+	return x, nil
+}
+
+// hasExtendedXMP returns the value of xmpNote:HasExtendedXMP, or "" if none.
+func hasExtendedXMP(packet []byte) string {
+	dec := xml.NewDecoder(bytes.NewReader(packet))
+	inElement := false
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			// no more tokens
+			return ""
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			if t.Name.Space == xmpNoteNamespace && t.Name.Local == "HasExtendedXMP" {
+				inElement = true
+				continue
+			}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == xmpNoteNamespace && attr.Name.Local == "HasExtendedXMP" {
+					return strings.TrimSpace(attr.Value)
+				}
+			}
+		case xml.CharData:
+			if inElement {
+				return strings.TrimSpace(string(t))
+			}
+		case xml.EndElement:
+			inElement = false
+		}
+	}
+}
+
+func reassembleExtendedXMP(guid string, chunks []*APP1Data) ([]byte, error) {
+	var portions []*APP1Data
+	for _, c := range chunks {
+		if strings.ToUpper(string(c.md5Digest[:])) == guid {
+			portions = append(portions, c)
+		}
+	}
+	if len(portions) == 0 {
+		return nil, fmt.Errorf("ExtendedXMP not found: %s", guid)
+	}
+
+	// The full length is bounded by the portions before the allocation.
+	fullLength := portions[0].fullLength
+	var total int64
+	for _, p := range portions {
+		total += int64(len(p.xmpPacket))
+	}
+	if fullLength > total {
+		return nil, fmt.Errorf("missing ExtendedXMP portion: %d < %d", total, fullLength)
+	}
+	sort.SliceStable(portions, func(i, j int) bool {
+		return portions[i].offsetThisPortion < portions[j].offsetThisPortion
+	})
+
+	extended := make([]byte, fullLength)
+	var covered int64
+	for _, p := range portions {
+		if p.fullLength != fullLength {
+			return nil, errors.New("inconsistent full length of ExtendedXMP")
+		}
+		end := p.offsetThisPortion + int64(len(p.xmpPacket))
+		if end > fullLength {
+			return nil, fmt.Errorf("ExtendedXMP portion overruns: %d+%d > %d", p.offsetThisPortion, len(p.xmpPacket), fullLength)
+		}
+		if p.offsetThisPortion > covered {
+			return nil, fmt.Errorf("missing ExtendedXMP portion: %d-%d", covered, p.offsetThisPortion)
+		}
+		copy(extended[p.offsetThisPortion:], p.xmpPacket)
+		if end > covered {
+			covered = end
+		}
+	}
+	if covered != fullLength {
+		return nil, fmt.Errorf("missing ExtendedXMP portion: %d-%d", covered, fullLength)
+	}
+
+	digest := md5.Sum(extended)
+	if strings.ToUpper(hex.EncodeToString(digest[:])) != guid {
+		return nil, fmt.Errorf("MD5 digest mismatch of ExtendedXMP: %s", guid)
+	}
+
+	return extended, nil
+}
+
+// Payloads returns the payloads of APP1 segments which carry the XMP:
+// the StandardXMP followed by the ExtendedXMP chunks.
+func (x *XMP) Payloads() ([][]byte, error) {
+	if len(x.Standard) > maxXMPPayloadSize-len(xmpIdentifier)-1 {
+		return nil, errors.New("StandardXMP is too large")
+	}
+
+	std := make([]byte, 0, len(xmpIdentifier)+1+len(x.Standard))
+	std = append(std, xmpIdentifier...)
+	std = append(std, 0)
+	std = append(std, x.Standard...)
+	payloads := [][]byte{std}
+
+	if len(x.Extended) == 0 {
+		return payloads, nil
+	}
+	if len(x.GUID) != 32 {
+		return nil, fmt.Errorf("invalid GUID of ExtendedXMP: %s", x.GUID)
+	}
+
+	header := len(extendedXMPIdentifier) + 1 + 32 + 4 + 4
+	chunkSize := maxXMPPayloadSize - header
+	for offset := 0; offset < len(x.Extended); offset += chunkSize {
+		end := offset + chunkSize
+		if end > len(x.Extended) {
+			end = len(x.Extended)
+		}
+		chunk := make([]byte, 0, header+end-offset)
+		chunk = append(chunk, extendedXMPIdentifier...)
+		chunk = append(chunk, 0)
+		chunk = append(chunk, x.GUID...)
+		chunk = binary.BigEndian.AppendUint32(chunk, uint32(len(x.Extended)))
+		chunk = binary.BigEndian.AppendUint32(chunk, uint32(offset))
+		chunk = append(chunk, x.Extended[offset:end]...)
+		payloads = append(payloads, chunk)
+	}
+
+	return payloads, nil
+}
@@ -0,0 +1,220 @@
+package jumbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Box type
+const (
+	TypeSuperbox    = "jumb"
+	TypeDescription = "jumd"
+	TypeCBOR        = "cbor"
+	TypeJSON        = "json"
+	TypeUUID        = "uuid"
+	TypeEmbedded    = "bidb" // binary data of the embedded file
+)
+
+// toggles of the description box
+const (
+	toggleRequestable = 1 << iota
+	toggleLabel
+	toggleID
+	toggleHash
+	togglePrivate
+)
+
+// UUID is the type of the superbox.
+type UUID [16]byte
+
+// String makes UUID satisfy the Stringer interface.
+func (u UUID) String() string {
+	s := hex.EncodeToString(u[:])
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// Description is the description box (jumd) of the superbox.
+type Description struct {
+	Type        UUID
+	Requestable bool
+	Label       string
+	HasID       bool
+	ID          uint32
+	Hash        []byte // SHA-256 of the content
+	Private     *Box
+}
+
+// Box is a box of JUMBF (ISO/IEC 19566-5).
+type Box struct {
+	Type string
+
+	// Payload is the payload excluding the box header. The payload of the
+	// superbox includes the description box and the child boxes.
+	Payload []byte
+
+	// description and child boxes of the superbox
+	Description *Description
+	Boxes       []*Box
+}
+
+// Parse parses the sequence of the boxes.
+func Parse(b []byte) ([]*Box, error) {
+	var boxes []*Box
+	for len(b) > 0 {
+		if len(b) < 8 {
+			return nil, errors.New("invalid box header")
+		}
+		size := uint64(binary.BigEndian.Uint32(b))
+		box := &Box{Type: string(b[4:8])}
+		header := uint64(8)
+		switch size {
+		case 0:
+			// to the end
+			size = uint64(len(b))
+		case 1:
+			if len(b) < 16 {
+				return nil, errors.New("invalid box header")
+			}
+			size = binary.BigEndian.Uint64(b[8:])
+			header = 16
+		}
+		if size < header || size > uint64(len(b)) {
+			return nil, fmt.Errorf("invalid length of box '%s': %d", box.Type, size)
+		}
+		box.Payload = b[header:size]
+		b = b[size:]
+
+		if box.Type == TypeSuperbox {
+			if err := box.parseSuperbox(); err != nil {
+				return nil, err
+			}
+		}
+		boxes = append(boxes, box)
+	}
+	return boxes, nil
+}
+
+func (b *Box) parseSuperbox() error {
+	boxes, err := Parse(b.Payload)
+	if err != nil {
+		return err
+	}
+	if len(boxes) == 0 || boxes[0].Type != TypeDescription {
+		return errors.New("no description box")
+	}
+
+	d, err := parseDescription(boxes[0].Payload)
+	if err != nil {
+		return err
+	}
+	b.Description = d
+	b.Boxes = boxes[1:]
+	return nil
+}
+
+func parseDescription(b []byte) (*Description, error) {
+	if len(b) < 17 {
+		return nil, errors.New("invalid description box")
+	}
+	d := &Description{}
+	copy(d.Type[:], b)
+	toggles := b[16]
+	b = b[17:]
+
+	d.Requestable = toggles&toggleRequestable != 0
+	if toggles&toggleLabel != 0 {
+		n := bytes.IndexByte(b, 0)
+		if n < 0 {
+			return nil, errors.New("unterminated label")
+		}
+		d.Label = string(b[:n])
+		b = b[n+1:]
+	}
+	if toggles&toggleID != 0 {
+		if len(b) < 4 {
+			return nil, errors.New("invalid ID of description box")
+		}
+		d.HasID = true
+		d.ID = binary.BigEndian.Uint32(b)
+		b = b[4:]
+	}
+	if toggles&toggleHash != 0 {
+		if len(b) < 32 {
+			return nil, errors.New("invalid hash of description box")
+		}
+		d.Hash = b[:32]
+		b = b[32:]
+	}
+	if toggles&togglePrivate != 0 {
+		boxes, err := Parse(b)
+		if err != nil {
+			return nil, err
+		}
+		if len(boxes) > 0 {
+			d.Private = boxes[0]
+		}
+	}
+	return d, nil
+}
+
+// Label returns the label of the superbox, or "" for the other boxes.
+func (b *Box) Label() string {
+	if b.Description == nil {
+		return ""
+	}
+	return b.Description.Label
+}
+
+// Child returns the first child superbox of the label, or nil if not found.
+func (b *Box) Child(label string) *Box {
+	for _, c := range b.Boxes {
+		if c.Description != nil && c.Description.Label == label {
+			return c
+		}
+	}
+	return nil
+}
+
+// Find returns the descendant superbox of the path of the labels separated
+// by '/', e.g. "c2pa.assertions/c2pa.hash.data", or nil if not found.
+func (b *Box) Find(path string) *Box {
+	for _, label := range strings.Split(path, "/") {
+		if b = b.Child(label); b == nil {
+			return nil
+		}
+	}
+	return b
+}
+
+// Content returns the first content box of the superbox of the type, or
+// nil if not found.
+func (b *Box) Content(typ string) *Box {
+	for _, c := range b.Boxes {
+		if c.Type == typ {
+			return c
+		}
+	}
+	return nil
+}
+
+// String makes Box satisfy the Stringer interface.
+func (b *Box) String() string {
+	var buf bytes.Buffer
+	b.dump(&buf, "")
+	return buf.String()
+}
+
+func (b *Box) dump(buf *bytes.Buffer, indent string) {
+	if b.Description == nil {
+		buf.WriteString(fmt.Sprintf("%s'%s': %d[bytes]\n", indent, b.Type, len(b.Payload)))
+		return
+	}
+	buf.WriteString(fmt.Sprintf("%s'%s' \"%s\": %s\n", indent, b.Type, b.Description.Label, b.Description.Type))
+	for _, c := range b.Boxes {
+		c.dump(buf, indent+"  ")
+	}
+}
@@ -0,0 +1,98 @@
+package motionphoto
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/ysh86/lspic/container"
+	"github.com/ysh86/lspic/jpeg"
+	"github.com/ysh86/lspic/xmp"
+)
+
+// MotionPhoto is the video embedded in the JPEG file.
+type MotionPhoto struct {
+	// GCamera:MotionPhotoVersion or GCamera:MicroVideoVersion
+	Version int
+	// presentation timestamp of the still image in the video (-1 if unspecified)
+	PresentationTimestampUs int64
+
+	// position of the video in the file
+	Offset int64
+	Length int64
+
+	Video *io.SectionReader
+}
+
+// Find finds the motion photo video (MP4) in the file described by p.
+// It returns nil if the file is not a motion photo.
+//
+// The newer format (GCamera:MotionPhoto) locates the video by the
+// Container:Directory item with Item:Semantic="MotionPhoto", and the older
+// format (GCamera:MicroVideo) by GCamera:MicroVideoOffset. Both are
+// relative to the end of the file.
+func Find(f *jpeg.File, p *xmp.Packet) (*MotionPhoto, error) {
+	m := &MotionPhoto{PresentationTimestampUs: -1}
+	size := f.Size()
+
+	switch {
+	case value(p, xmp.NsGCamera, "MotionPhoto") == "1":
+		m.Version, _ = strconv.Atoi(value(p, xmp.NsGCamera, "MotionPhotoVersion"))
+		if ts := value(p, xmp.NsGCamera, "MotionPhotoPresentationTimestampUs"); ts != "" {
+			m.PresentationTimestampUs, _ = strconv.ParseInt(ts, 10, 64)
+		}
+
+		d, err := container.Parse(f, p)
+		if err != nil {
+			return nil, err
+		}
+		if d == nil {
+			return nil, errors.New("no Container:Directory")
+		}
+		item := d.Find(container.SemanticMotionPhoto)
+		if item == nil {
+			return nil, errors.New("no MotionPhoto item in Container:Directory")
+		}
+		m.Offset = item.Offset
+		m.Length = item.Length
+	case value(p, xmp.NsGCamera, "MicroVideo") == "1":
+		m.Version, _ = strconv.Atoi(value(p, xmp.NsGCamera, "MicroVideoVersion"))
+		if ts := value(p, xmp.NsGCamera, "MicroVideoPresentationTimestampUs"); ts != "" {
+			m.PresentationTimestampUs, _ = strconv.ParseInt(ts, 10, 64)
+		}
+
+		offset, err := strconv.ParseInt(value(p, xmp.NsGCamera, "MicroVideoOffset"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GCamera:MicroVideoOffset: %w", err)
+		}
+		m.Offset = size - offset
+		m.Length = offset
+	default:
+		return nil, nil
+	}
+
+	if m.Offset < 0 || m.Length <= 0 || m.Offset+m.Length > size {
+		return nil, fmt.Errorf("video is out of the file: %d+%d", m.Offset, m.Length)
+	}
+	m.Video = f.Section(m.Offset, m.Length)
+
+	// ftyp box
+	var box [8]byte
+	if _, err := m.Video.ReadAt(box[:], 0); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(box[4:8], []byte("ftyp")) {
+		return nil, fmt.Errorf("no ftyp box at %08x", m.Offset)
+	}
+
+	return m, nil
+}
+
+func value(p *xmp.Packet, ns, name string) string {
+	if prop := p.Property(ns, name); prop != nil {
+		return prop.Value
+	}
+	return ""
+}
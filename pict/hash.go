@@ -0,0 +1,33 @@
+package pict
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+// ContentHash returns SHA-256 of the unpacked pixel data of the bitmaps
+// and their bounds. The other opcodes don't affect it.
+func (f *File) ContentHash() ([]byte, error) {
+	h := sha256.New()
+	found := false
+	for _, op := range f.Ops {
+		o, ok := op.(*OpPackBitsRect)
+		if !ok {
+			continue
+		}
+		found = true
+
+		bounds := []uint16{o.RowBytes, uint16(o.Bounds.Dx()), uint16(o.Bounds.Dy())}
+		if err := binary.Write(h, binary.BigEndian, bounds); err != nil {
+			return nil, err
+		}
+		for _, row := range o.unpacked {
+			h.Write(row)
+		}
+	}
+	if !found {
+		return nil, errors.New("no bitmap")
+	}
+	return h.Sum(nil), nil
+}
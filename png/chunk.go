@@ -8,7 +8,7 @@ import (
 )
 
 type Chunk struct {
-	reader io.Reader
+	reader *io.SectionReader
 }
 
 func (c *Chunk) Dump() {
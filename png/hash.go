@@ -0,0 +1,64 @@
+package png
+
+import (
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// header returns the length and the type of the chunk.
+func (c *Chunk) header() (int64, string, error) {
+	var buf [8]byte
+	if _, err := c.reader.ReadAt(buf[:], 0); err != nil {
+		return 0, "", err
+	}
+	return int64(binary.BigEndian.Uint32(buf[:4])), string(buf[4:]), nil
+}
+
+// data returns a reader of the chunk data.
+func (c *Chunk) data(length int64) *io.SectionReader {
+	return io.NewSectionReader(c.reader, 4+4, length)
+}
+
+// ContentHash returns SHA-256 of the image independent of the metadata:
+// IHDR, PLTE and the decompressed IDAT stream. The other ancillary chunks
+// (tEXt, iTXt, eXIf, etc.) and the compression level don't affect it.
+func (f *File) ContentHash() ([]byte, error) {
+	h := sha256.New()
+	var idat []io.Reader
+	for _, c := range f.Chunks {
+		length, chunkType, err := c.header()
+		if err != nil {
+			return nil, err
+		}
+		switch chunkType {
+		case "IHDR", "PLTE":
+			if _, err := io.WriteString(h, chunkType); err != nil {
+				return nil, err
+			}
+			if _, err := io.Copy(h, c.data(length)); err != nil {
+				return nil, err
+			}
+		case "IDAT":
+			idat = append(idat, c.data(length))
+		}
+	}
+	if len(idat) == 0 {
+		return nil, errors.New("no IDAT")
+	}
+
+	zr, err := zlib.NewReader(io.MultiReader(idat...))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	if _, err := io.WriteString(h, "IDAT"); err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(h, zr); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,127 @@
+package seft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ysh86/lspic/jpeg"
+)
+
+// Entry is an entry of the Samsung trailer, e.g. Image_UTC_Data,
+// MotionPhoto_Data, DualShot_Extra_Info.
+type Entry struct {
+	Type uint16
+	Name string
+
+	// position of the data (following the name) in the file
+	Offset int64
+	Length int64
+
+	Data *io.SectionReader
+}
+
+// Directory is the SEFH directory of the Samsung trailer.
+type Directory struct {
+	Version uint32
+	// position of SEFH in the file
+	Offset int64
+
+	Entries []*Entry
+}
+
+// Find finds the Samsung trailer (SEFH/SEFT) after EOI.
+// It returns nil if the file has no trailer.
+//
+// The file ends with the length of the directory and "SEFT". The directory
+// starts with "SEFH", the version and the count of the entries, followed by
+// the entries of 12 bytes: the type, the offset of the entry back from
+// SEFH and its length. Each entry starts with the type and its name.
+func Find(f *jpeg.File) (*Directory, error) {
+	start := f.End()
+	size := f.Size()
+	if size-start < 8 {
+		return nil, nil
+	}
+
+	// footer
+	var footer [8]byte
+	if _, err := f.Section(size-8, 8).ReadAt(footer[:], 0); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(footer[4:], []byte("SEFT")) {
+		return nil, nil
+	}
+	dirLen := int64(binary.LittleEndian.Uint32(footer[:4]))
+	dirPos := size - 8 - dirLen
+	if dirLen < 12 || dirPos < start {
+		return nil, fmt.Errorf("invalid length of SEFH: %d", dirLen)
+	}
+
+	// directory
+	dir := make([]byte, dirLen)
+	if _, err := f.Section(dirPos, dirLen).ReadAt(dir, 0); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(dir[:4], []byte("SEFH")) {
+		return nil, errors.New("no SEFH")
+	}
+	d := &Directory{
+		Version: binary.LittleEndian.Uint32(dir[4:]),
+		Offset:  dirPos,
+	}
+	count := int64(binary.LittleEndian.Uint32(dir[8:]))
+	if 12+count*12 > dirLen {
+		return nil, fmt.Errorf("invalid count of SEFH: %d", count)
+	}
+
+	for i := int64(0); i < count; i++ {
+		b := dir[12+i*12:]
+		typ := binary.LittleEndian.Uint16(b[2:])
+		offset := dirPos - int64(binary.LittleEndian.Uint32(b[4:]))
+		length := int64(binary.LittleEndian.Uint32(b[8:]))
+		if offset < start || length < 8 || offset+length > dirPos {
+			return nil, fmt.Errorf("entry %d is out of the trailer: %08x+%d", i, offset, length)
+		}
+
+		// entry header: reserved, type, length of the name
+		var header [8]byte
+		if _, err := f.Section(offset, 8).ReadAt(header[:], 0); err != nil {
+			return nil, err
+		}
+		if t := binary.LittleEndian.Uint16(header[2:]); t != typ {
+			return nil, fmt.Errorf("type mismatch of entry %d: %04x != %04x", i, t, typ)
+		}
+		nameLen := int64(binary.LittleEndian.Uint32(header[4:]))
+		if 8+nameLen > length {
+			return nil, fmt.Errorf("invalid name of entry %d", i)
+		}
+		name := make([]byte, nameLen)
+		if _, err := f.Section(offset+8, nameLen).ReadAt(name, 0); err != nil {
+			return nil, err
+		}
+
+		e := &Entry{
+			Type:   typ,
+			Name:   string(name),
+			Offset: offset + 8 + nameLen,
+			Length: length - 8 - nameLen,
+		}
+		e.Data = f.Section(e.Offset, e.Length)
+		d.Entries = append(d.Entries, e)
+	}
+
+	return d, nil
+}
+
+// Entry returns the first entry of the name, or nil if not found.
+func (d *Directory) Entry(name string) *Entry {
+	for _, e := range d.Entries {
+		if e.Name == name {
+			return e
+		}
+	}
+	return nil
+}
@@ -107,3 +107,64 @@ func (f *File) parseIFDs() error {
 
 	return nil
 }
+
+// ByteOrder returns the byte order of the TIFF stream.
+func (f *File) ByteOrder() binary.ByteOrder {
+	return f.byteOrder
+}
+
+// Entry looks up the entry of tag in the n-th IFD.
+func (f *File) Entry(n int, tag uint16) *IFDEntry {
+	if n < 0 || n >= len(f.IFDs) {
+		return nil
+	}
+	for _, entry := range f.IFDs[n] {
+		if entry.Tag == tag {
+			return entry
+		}
+	}
+	return nil
+}
+
+// RawValue reads the raw bytes of the value of e.
+func (f *File) RawValue(e *IFDEntry) ([]byte, error) {
+	size := e.elementSize() * int64(e.Count)
+	if size == 0 {
+		return nil, errors.New("unknown type of IFD entry")
+	}
+	if e.valueOffset < 0 || e.valueOffset > f.reader.Size() || size > f.reader.Size()-e.valueOffset {
+		return nil, errors.New("value of IFD entry out of the stream")
+	}
+	buf := make([]byte, size)
+	if _, err := f.reader.ReadAt(buf, e.valueOffset); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Uints reads the value of e as unsigned integers.
+func (f *File) Uints(e *IFDEntry) ([]uint32, error) {
+	raw, err := f.RawValue(e)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]uint32, 0, e.Count)
+	switch e.IFDType {
+	case BYTE, UNDEFINED:
+		for _, b := range raw {
+			values = append(values, uint32(b))
+		}
+	case SHORT:
+		for i := 0; i+2 <= len(raw); i += 2 {
+			values = append(values, uint32(f.byteOrder.Uint16(raw[i:])))
+		}
+	case LONG:
+		for i := 0; i+4 <= len(raw); i += 4 {
+			values = append(values, f.byteOrder.Uint32(raw[i:]))
+		}
+	default:
+		return nil, fmt.Errorf("not an unsigned integer type: %d", e.IFDType)
+	}
+	return values, nil
+}
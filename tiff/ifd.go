@@ -13,6 +13,18 @@ const (
 
 	ImageWidth  uint16 = 0x0100
 	ImageLength uint16 = 0x0101
+
+	Make                        uint16 = 0x010f
+	Model                       uint16 = 0x0110
+	Orientation                 uint16 = 0x0112
+	Software                    uint16 = 0x0131
+	JPEGInterchangeFormat       uint16 = 0x0201
+	JPEGInterchangeFormatLength uint16 = 0x0202
+	ExifIFDPointer              uint16 = 0x8769
+	GPSInfoIFDPointer           uint16 = 0x8825
+	PixelXDimension             uint16 = 0xa002
+	PixelYDimension             uint16 = 0xa003
+	InteroperabilityIFDPointer  uint16 = 0xa005
 )
 
 // IFD Type
@@ -29,8 +41,8 @@ const (
 	SSHORT    // []int16
 	SLONG     // []int32
 	SRATIONAL // []*big.Rat {num: int32, den: int32}
-	// FLOAT
-	// DOUBLE
+	FLOAT     // []float32
+	DOUBLE    // []float64
 )
 
 // IFDEntry is the IFD entry
@@ -45,6 +57,9 @@ type IFDEntry struct {
 	// for debug
 	globalOffset int64
 
+	// offset of the value in the TIFF stream (inline or not)
+	valueOffset int64
+
 	// cache
 	elmSize int64
 }
@@ -82,6 +97,10 @@ func parseIFD(rs io.ReadSeeker, byteOrder binary.ByteOrder, globalOffset int64)
 			return 0, entries, err
 		}
 		// Offset or Value
+		pos, err := rs.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, entries, err
+		}
 		totalBytes := entry.elementSize() * int64(entry.Count)
 		if totalBytes > 4 {
 			// Offset
@@ -89,12 +108,14 @@ func parseIFD(rs io.ReadSeeker, byteOrder binary.ByteOrder, globalOffset int64)
 				return 0, entries, err
 			}
 			entry.Values = nil
+			entry.valueOffset = int64(entry.Offset)
 		} else {
 			// Value
 			entry.Offset = 0
 			if err := entry.parseValue4bytes(rs, byteOrder); err != nil {
 				return 0, entries, err
 			}
+			entry.valueOffset = pos
 		}
 		entry.globalOffset = globalOffset + int64(entry.Offset)
 
@@ -114,34 +135,25 @@ func (e *IFDEntry) elementSize() int64 {
 		return e.elmSize
 	}
 
-	switch e.IFDType {
-	case BYTE:
-		e.elmSize = 1
-	case ASCII:
-		e.elmSize = 1
-	case SHORT:
-		e.elmSize = 2
-	case LONG:
-		e.elmSize = 4
-	case RATIONAL:
-		e.elmSize = 4 + 4
-	case SBYTE:
-		e.elmSize = 1
-	case UNDEFINED:
-		e.elmSize = 1
-	case SSHORT:
-		e.elmSize = 2
-	case SLONG:
-		e.elmSize = 4
-	case SRATIONAL:
-		e.elmSize = 4 + 4
-	default:
-		e.elmSize = 0
-	}
-
+	e.elmSize = typeSize(e.IFDType)
 	return e.elmSize
 }
 
+// typeSize returns the size of an element of the type, or 0 if unknown.
+func typeSize(t uint16) int64 {
+	switch t {
+	case BYTE, ASCII, SBYTE, UNDEFINED:
+		return 1
+	case SHORT, SSHORT:
+		return 2
+	case LONG, SLONG, FLOAT:
+		return 4
+	case RATIONAL, SRATIONAL, DOUBLE:
+		return 4 + 4
+	}
+	return 0
+}
+
 func (e *IFDEntry) parseValue4bytes(rs io.ReadSeeker, byteOrder binary.ByteOrder) error {
 	pos, err := rs.Seek(0, io.SeekCurrent)
 	if err != nil {
@@ -0,0 +1,242 @@
+package tiff
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// maximum depth of the sub-IFDs
+const maxDirectoryDepth = 4
+
+// Field is an IFD entry with the raw value in the byte order of the stream.
+type Field struct {
+	Tag   uint16
+	Type  uint16
+	Count uint32
+	Value []byte
+}
+
+// Directory is an IFD with its sub-IFDs, which can be modified and encoded
+// into a new TIFF stream.
+type Directory struct {
+	Fields []*Field
+
+	// sub-IFDs referred by the pointer tags (Exif, GPS, Interoperability)
+	SubIFDs map[uint16]*Directory
+
+	// JPEG thumbnail referred by JPEGInterchangeFormat
+	Thumbnail []byte
+
+	// next IFD (the 1st IFD of Exif)
+	Next *Directory
+}
+
+func isPointerTag(tag uint16) bool {
+	return tag == ExifIFDPointer || tag == GPSInfoIFDPointer || tag == InteroperabilityIFDPointer
+}
+
+// Directory reads the IFDs of the stream with their sub-IFDs and the
+// JPEG thumbnail. The values referred by other offsets (e.g. StripOffsets,
+// the offsets in MakerNote) are not relocated.
+func (f *File) Directory() (*Directory, error) {
+	visited := make(map[int64]bool)
+	return f.readDirectory(f.offsetNext, 0, visited)
+}
+
+func (f *File) readDirectory(offset int64, depth int, visited map[int64]bool) (*Directory, error) {
+	if depth > maxDirectoryDepth {
+		return nil, errors.New("too deep IFDs")
+	}
+	if visited[offset] {
+		return nil, fmt.Errorf("loop of IFDs at %08x", offset)
+	}
+	visited[offset] = true
+
+	if _, err := f.reader.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	offsetNext, entries, err := parseIFD(f.reader, f.byteOrder, f.globalOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Directory{SubIFDs: make(map[uint16]*Directory)}
+	var thumbnailOffset, thumbnailLength int64 = -1, -1
+	for _, e := range entries {
+		if isPointerTag(e.Tag) || e.Tag == JPEGInterchangeFormat || e.Tag == JPEGInterchangeFormatLength {
+			values, err := f.Uints(e)
+			if err != nil || len(values) != 1 {
+				return nil, fmt.Errorf("invalid pointer tag %04x", e.Tag)
+			}
+			switch e.Tag {
+			case JPEGInterchangeFormat:
+				thumbnailOffset = int64(values[0])
+			case JPEGInterchangeFormatLength:
+				thumbnailLength = int64(values[0])
+			default:
+				sub, err := f.readDirectory(int64(values[0]), depth+1, visited)
+				if err != nil {
+					return nil, err
+				}
+				d.SubIFDs[e.Tag] = sub
+			}
+			continue
+		}
+
+		value, err := f.RawValue(e)
+		if err != nil {
+			return nil, fmt.Errorf("tag %04x: %w", e.Tag, err)
+		}
+		d.Fields = append(d.Fields, &Field{Tag: e.Tag, Type: e.IFDType, Count: e.Count, Value: value})
+	}
+
+	if thumbnailOffset >= 0 && thumbnailLength > 0 {
+		if thumbnailOffset > f.reader.Size() || thumbnailLength > f.reader.Size()-thumbnailOffset {
+			return nil, errors.New("invalid thumbnail")
+		}
+		d.Thumbnail = make([]byte, thumbnailLength)
+		if _, err := f.reader.ReadAt(d.Thumbnail, thumbnailOffset); err != nil {
+			return nil, errors.New("invalid thumbnail")
+		}
+	}
+
+	if offsetNext != 0 && depth == 0 {
+		if d.Next, err = f.readDirectory(offsetNext, depth, visited); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// Field returns the field of tag, or nil if the directory has no such field.
+func (d *Directory) Field(tag uint16) *Field {
+	for _, field := range d.Fields {
+		if field.Tag == tag {
+			return field
+		}
+	}
+	return nil
+}
+
+// Keep removes the fields of the directory and its sub-IFDs which keep
+// reports false. The sub-IFDs without fields are removed. The next IFD is
+// not changed.
+func (d *Directory) Keep(keep func(tag uint16) bool) {
+	fields := d.Fields[:0]
+	for _, field := range d.Fields {
+		if keep(field.Tag) {
+			fields = append(fields, field)
+		}
+	}
+	d.Fields = fields
+
+	for tag, sub := range d.SubIFDs {
+		sub.Keep(keep)
+		if len(sub.Fields) == 0 && len(sub.SubIFDs) == 0 {
+			delete(d.SubIFDs, tag)
+		}
+	}
+}
+
+// Encode encodes the directory into a TIFF stream in the byte order.
+func Encode(d *Directory, byteOrder binary.ByteOrder) ([]byte, error) {
+	b := make([]byte, 8)
+	if byteOrder == binary.LittleEndian {
+		copy(b, "II")
+	} else {
+		copy(b, "MM")
+	}
+	byteOrder.PutUint16(b[2:], 0x002a)
+	byteOrder.PutUint32(b[4:], 8)
+
+	return d.encode(b, byteOrder)
+}
+
+func (d *Directory) encode(b []byte, byteOrder binary.ByteOrder) ([]byte, error) {
+	type entry struct {
+		*Field
+		sub *Directory
+	}
+	var entries []entry
+	for _, field := range d.Fields {
+		if isPointerTag(field.Tag) || field.Tag == JPEGInterchangeFormat || field.Tag == JPEGInterchangeFormatLength {
+			continue
+		}
+		if len(field.Value) != int(typeSize(field.Type))*int(field.Count) {
+			return nil, fmt.Errorf("invalid value of tag %04x", field.Tag)
+		}
+		entries = append(entries, entry{Field: field})
+	}
+	for tag, sub := range d.SubIFDs {
+		entries = append(entries, entry{Field: &Field{Tag: tag, Type: LONG, Count: 1, Value: make([]byte, 4)}, sub: sub})
+	}
+	if d.Thumbnail != nil {
+		length := make([]byte, 4)
+		byteOrder.PutUint32(length, uint32(len(d.Thumbnail)))
+		entries = append(entries,
+			entry{Field: &Field{Tag: JPEGInterchangeFormat, Type: LONG, Count: 1, Value: make([]byte, 4)}},
+			entry{Field: &Field{Tag: JPEGInterchangeFormatLength, Type: LONG, Count: 1, Value: length}},
+		)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Tag < entries[j].Tag })
+
+	// IFD: count, entries, next
+	b = align(b)
+	ifd := len(b)
+	b = append(b, make([]byte, 2+12*len(entries)+4)...)
+	byteOrder.PutUint16(b[ifd:], uint16(len(entries)))
+
+	// values over 4 bytes follow the IFD
+	for i, e := range entries {
+		pos := ifd + 2 + 12*i
+		byteOrder.PutUint16(b[pos:], e.Tag)
+		byteOrder.PutUint16(b[pos+2:], e.Type)
+		byteOrder.PutUint32(b[pos+4:], e.Count)
+		if len(e.Value) <= 4 {
+			copy(b[pos+8:], e.Value)
+			continue
+		}
+		b = align(b)
+		byteOrder.PutUint32(b[pos+8:], uint32(len(b)))
+		b = append(b, e.Value...)
+	}
+
+	// sub-IFDs and thumbnail
+	var err error
+	for i, e := range entries {
+		pos := ifd + 2 + 12*i
+		switch {
+		case e.sub != nil:
+			b = align(b)
+			byteOrder.PutUint32(b[pos+8:], uint32(len(b)))
+			if b, err = e.sub.encode(b, byteOrder); err != nil {
+				return nil, err
+			}
+		case e.Tag == JPEGInterchangeFormat:
+			byteOrder.PutUint32(b[pos+8:], uint32(len(b)))
+			b = append(b, d.Thumbnail...)
+		}
+	}
+
+	if d.Next != nil {
+		b = align(b)
+		byteOrder.PutUint32(b[ifd+2+12*len(entries):], uint32(len(b)))
+		if b, err = d.Next.encode(b, byteOrder); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// align makes the offset of the next data even.
+func align(b []byte) []byte {
+	if len(b)%2 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
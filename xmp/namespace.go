@@ -0,0 +1,114 @@
+package xmp
+
+// Namespace URI
+const (
+	NsX         = "adobe:ns:meta/"
+	NsRDF       = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	NsXML       = "http://www.w3.org/XML/1998/namespace"
+	NsDC        = "http://purl.org/dc/elements/1.1/"
+	NsXMP       = "http://ns.adobe.com/xap/1.0/"
+	NsXMPMM     = "http://ns.adobe.com/xap/1.0/mm/"
+	NsXMPRights = "http://ns.adobe.com/xap/1.0/rights/"
+	NsXMPNote   = "http://ns.adobe.com/xmp/note/"
+	NsStEvt     = "http://ns.adobe.com/xap/1.0/sType/ResourceEvent#"
+	NsStRef     = "http://ns.adobe.com/xap/1.0/sType/ResourceRef#"
+	NsPhotoshop = "http://ns.adobe.com/photoshop/1.0/"
+	NsTIFF      = "http://ns.adobe.com/tiff/1.0/"
+	NsExif      = "http://ns.adobe.com/exif/1.0/"
+	NsExifEX    = "http://cipa.jp/exif/1.0/"
+	NsAux       = "http://ns.adobe.com/exif/1.0/aux/"
+	NsCRS       = "http://ns.adobe.com/camera-raw-settings/1.0/"
+	NsIptcCore  = "http://iptc.org/std/Iptc4xmpCore/1.0/xmlns/"
+	NsIptcExt   = "http://iptc.org/std/Iptc4xmpExt/2008-02-29/"
+
+	// Google
+	NsGDepth     = "http://ns.google.com/photos/1.0/depthmap/"
+	NsGImage     = "http://ns.google.com/photos/1.0/image/"
+	NsGFocus     = "http://ns.google.com/photos/1.0/focus/"
+	NsGCamera    = "http://ns.google.com/photos/1.0/camera/"
+	NsGCreations = "http://ns.google.com/photos/1.0/creations/"
+	NsGPano      = "http://ns.google.com/photos/1.0/panorama/"
+
+	// Container (Motion Photo)
+	NsContainer = "http://ns.google.com/photos/1.0/container/"
+	NsItem      = "http://ns.google.com/photos/1.0/container/item/"
+
+	// Dynamic Depth
+	NsDevice       = "http://ns.google.com/photos/dd/1.0/device/"
+	NsDDContainer  = "http://ns.google.com/photos/dd/1.0/container/"
+	NsDDItem       = "http://ns.google.com/photos/dd/1.0/item/"
+	NsProfile      = "http://ns.google.com/photos/dd/1.0/profile/"
+	NsCamera       = "http://ns.google.com/photos/dd/1.0/camera/"
+	NsDepthMap     = "http://ns.google.com/photos/dd/1.0/depthmap/"
+	NsImage        = "http://ns.google.com/photos/dd/1.0/image/"
+	NsImagingModel = "http://ns.google.com/photos/dd/1.0/imagingmodel/"
+	NsPose         = "http://ns.google.com/photos/dd/1.0/pose/"
+
+	// HDR gain map
+	NsHDRGM = "http://ns.adobe.com/hdr-gain-map/1.0/"
+
+	// Apple
+	NsAPDI       = "http://ns.apple.com/pixeldatainfo/1.0/"
+	NsHDRGainMap = "http://ns.apple.com/HDRGainMap/1.0/"
+)
+
+var (
+	wellKnownPrefix    map[string]string
+	wellKnownNamespace map[string]string
+)
+
+func init() {
+	wellKnownPrefix = map[string]string{
+		NsX:         "x",
+		NsRDF:       "rdf",
+		NsXML:       "xml",
+		NsDC:        "dc",
+		NsXMP:       "xmp",
+		NsXMPMM:     "xmpMM",
+		NsXMPRights: "xmpRights",
+		NsXMPNote:   "xmpNote",
+		NsStEvt:     "stEvt",
+		NsStRef:     "stRef",
+		NsPhotoshop: "photoshop",
+		NsTIFF:      "tiff",
+		NsExif:      "exif",
+		NsExifEX:    "exifEX",
+		NsAux:       "aux",
+		NsCRS:       "crs",
+		NsIptcCore:  "Iptc4xmpCore",
+		NsIptcExt:   "Iptc4xmpExt",
+
+		NsGDepth:     "GDepth",
+		NsGImage:     "GImage",
+		NsGFocus:     "GFocus",
+		NsGCamera:    "GCamera",
+		NsGCreations: "GCreations",
+		NsGPano:      "GPano",
+
+		NsContainer: "Container",
+		NsItem:      "Item",
+
+		NsDevice:       "Device",
+		NsDDContainer:  "Container",
+		NsDDItem:       "Item",
+		NsProfile:      "Profile",
+		NsCamera:       "Camera",
+		NsDepthMap:     "DepthMap",
+		NsImage:        "Image",
+		NsImagingModel: "ImagingModel",
+		NsPose:         "Pose",
+
+		NsHDRGM: "hdrgm",
+
+		NsAPDI:       "apdi",
+		NsHDRGainMap: "HDRGainMap",
+	}
+
+	wellKnownNamespace = map[string]string{}
+	for uri, prefix := range wellKnownPrefix {
+		wellKnownNamespace[prefix] = uri
+	}
+	// prefer Motion Photo to Dynamic Depth for the shared prefixes
+	wellKnownNamespace["Container"] = NsContainer
+	wellKnownNamespace["Item"] = NsItem
+}
@@ -0,0 +1,287 @@
+package xmp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+// element is a node of the XML tree.
+type element struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*element
+	text     bytes.Buffer
+}
+
+func (e *element) is(ns, local string) bool {
+	return e.name.Space == ns && e.name.Local == local
+}
+
+// Parse parses XMP packet(s) into the XMP data model.
+// Multiple x:xmpmeta or rdf:RDF in b (e.g. StandardXMP followed by
+// ExtendedXMP) are merged into one Packet.
+func Parse(b []byte) (*Packet, error) {
+	p := NewPacket()
+
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	dec.Strict = false
+
+	found := false
+	var stack []*element
+	for {
+		t, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if found {
+				// trailing garbage (e.g. padding)
+				break
+			}
+			return nil, err
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			e := &element{name: t.Name, attrs: t.Attr}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" {
+					p.RegisterNamespace(a.Name.Local, a.Value)
+				}
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, e)
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, errors.New("unbalanced XML")
+			}
+			e := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if e.is(NsRDF, "RDF") {
+				if err := p.parseRDF(e); err != nil {
+					return nil, err
+				}
+				found = true
+				if len(stack) > 0 {
+					// no need to keep the tree
+					parent := stack[len(stack)-1]
+					parent.children = parent.children[:len(parent.children)-1]
+				}
+			}
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		}
+	}
+
+	if !found {
+		return nil, errors.New("rdf:RDF not found")
+	}
+	return p, nil
+}
+
+func (p *Packet) parseRDF(rdf *element) error {
+	for _, desc := range rdf.children {
+		if !desc.is(NsRDF, "Description") {
+			// typed node
+			prop, err := p.parseNode(desc)
+			if err != nil {
+				return err
+			}
+			p.add(prop)
+			continue
+		}
+
+		props, err := p.parseDescription(desc)
+		if err != nil {
+			return err
+		}
+		for _, prop := range props {
+			p.add(prop)
+		}
+	}
+	return nil
+}
+
+func (p *Packet) add(prop *Property) {
+	if old := p.Property(prop.Namespace, prop.Name); old != nil && old.Kind == Struct && prop.Kind == Struct {
+		old.Fields = append(old.Fields, prop.Fields...)
+		return
+	}
+	p.Properties = append(p.Properties, prop)
+}
+
+// parseDescription parses the property attributes and the property
+// elements of rdf:Description (or a node element).
+func (p *Packet) parseDescription(desc *element) ([]*Property, error) {
+	var props []*Property
+	for _, a := range desc.attrs {
+		if isSyntaxAttr(a.Name) {
+			continue
+		}
+		props = append(props, &Property{
+			Namespace: a.Name.Space,
+			Name:      a.Name.Local,
+			Kind:      Simple,
+			Value:     a.Value,
+		})
+	}
+	for _, child := range desc.children {
+		prop, err := p.parseNode(child)
+		if err != nil {
+			return nil, err
+		}
+		props = append(props, prop)
+	}
+	return props, nil
+}
+
+func isSyntaxAttr(name xml.Name) bool {
+	switch name.Space {
+	case "xmlns", NsXML:
+		return true
+	case NsRDF:
+		switch name.Local {
+		case "about", "ID", "nodeID", "datatype", "parseType", "resource":
+			return true
+		}
+	case "":
+		// xmlns="..." or unqualified attributes
+		return true
+	}
+	return false
+}
+
+// parseNode parses a property element.
+func (p *Packet) parseNode(e *element) (*Property, error) {
+	prop := &Property{Namespace: e.name.Space, Name: e.name.Local}
+
+	var propAttrs []xml.Attr
+	parseType := ""
+	resource, hasResource := "", false
+	for _, a := range e.attrs {
+		switch {
+		case a.Name.Space == NsXML && a.Name.Local == "lang":
+			prop.Qualifiers = append(prop.Qualifiers, &Property{
+				Namespace: NsXML,
+				Name:      "lang",
+				Kind:      Simple,
+				Value:     a.Value,
+			})
+		case a.Name.Space == NsRDF && a.Name.Local == "parseType":
+			parseType = a.Value
+		case a.Name.Space == NsRDF && a.Name.Local == "resource":
+			resource, hasResource = a.Value, true
+		case isSyntaxAttr(a.Name):
+		default:
+			propAttrs = append(propAttrs, a)
+		}
+	}
+
+	switch {
+	case parseType == "Resource":
+		// struct (or qualified value) in the element form
+		fields, err := p.parseDescription(&element{children: e.children})
+		if err != nil {
+			return nil, err
+		}
+		prop.setStruct(fields)
+	case len(e.children) == 1 && isArray(e.children[0]):
+		arr := e.children[0]
+		switch arr.name.Local {
+		case "Bag":
+			prop.Kind = Bag
+		case "Seq":
+			prop.Kind = Seq
+		case "Alt":
+			prop.Kind = Alt
+		}
+		for _, li := range arr.children {
+			if !li.is(NsRDF, "li") {
+				return nil, errors.New("invalid array item: " + li.name.Local)
+			}
+			item, err := p.parseNode(li)
+			if err != nil {
+				return nil, err
+			}
+			item.Namespace, item.Name = "", ""
+			prop.Items = append(prop.Items, item)
+		}
+	case len(e.children) > 0:
+		// rdf:Description or a typed node
+		var fields []*Property
+		for _, child := range e.children {
+			props, err := p.parseDescription(child)
+			if err != nil {
+				return nil, err
+			}
+			if !child.is(NsRDF, "Description") {
+				props = append(props, &Property{
+					Namespace: NsRDF,
+					Name:      "type",
+					Kind:      Simple,
+					Value:     child.name.Space + child.name.Local,
+					URI:       true,
+				})
+			}
+			fields = append(fields, props...)
+		}
+		prop.setStruct(fields)
+	case hasResource:
+		prop.Kind = Simple
+		prop.Value = resource
+		prop.URI = true
+	case len(propAttrs) > 0:
+		// struct in the attribute form
+		fields, err := p.parseDescription(&element{attrs: propAttrs})
+		if err != nil {
+			return nil, err
+		}
+		prop.setStruct(fields)
+	default:
+		prop.Kind = Simple
+		prop.Value = e.text.String()
+	}
+
+	return prop, nil
+}
+
+// setStruct makes prop a struct, or a simple value with qualifiers
+// if rdf:value is in the fields.
+func (prop *Property) setStruct(fields []*Property) {
+	var value *Property
+	var others []*Property
+	for _, f := range fields {
+		if f.Namespace == NsRDF && f.Name == "value" {
+			value = f
+		} else {
+			others = append(others, f)
+		}
+	}
+
+	if value == nil {
+		prop.Kind = Struct
+		prop.Fields = fields
+		return
+	}
+
+	prop.Kind = value.Kind
+	prop.Value = value.Value
+	prop.URI = value.URI
+	prop.Fields = value.Fields
+	prop.Items = value.Items
+	prop.Qualifiers = append(prop.Qualifiers, others...)
+}
+
+func isArray(e *element) bool {
+	if e.name.Space != NsRDF {
+		return false
+	}
+	return e.name.Local == "Bag" || e.name.Local == "Seq" || e.name.Local == "Alt"
+}
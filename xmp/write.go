@@ -0,0 +1,369 @@
+package xmp
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Limits of XMP in JPEG (XMP Specification Part 3)
+const (
+	// 65535 - 2 (length) - 29 ("http://ns.adobe.com/xap/1.0/\0")
+	MaxStandardXMPSize = 65504
+	// 65535 - 2 (length) - 35 ("http://ns.adobe.com/xmp/extension/\0") - 32 (GUID) - 4 - 4
+	MaxExtendedXMPChunkSize = 65458
+)
+
+const (
+	xpacketBegin = "<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n"
+	xpacketEnd   = "<?xpacket end=\"w\"?>"
+	toolkit      = "lspic"
+)
+
+// Set adds prop to the top-level properties, replacing the existing one.
+func (p *Packet) Set(prop *Property) {
+	for i, old := range p.Properties {
+		if old.Namespace == prop.Namespace && old.Name == prop.Name {
+			p.Properties[i] = prop
+			return
+		}
+	}
+	p.Properties = append(p.Properties, prop)
+}
+
+// Remove removes the top-level property.
+func (p *Packet) Remove(ns, name string) {
+	props := p.Properties[:0]
+	for _, prop := range p.Properties {
+		if prop.Namespace != ns || prop.Name != name {
+			props = append(props, prop)
+		}
+	}
+	p.Properties = props
+}
+
+// Marshal serializes the packet into RDF/XML without the xpacket wrapper.
+func (p *Packet) Marshal() ([]byte, error) {
+	prefixes, err := p.assignPrefixes()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("<x:xmpmeta xmlns:x=\"%s\" x:xmptk=\"%s\">\n", NsX, toolkit))
+	buf.WriteString(fmt.Sprintf(" <rdf:RDF xmlns:rdf=\"%s\">\n", NsRDF))
+	buf.WriteString("  <rdf:Description rdf:about=\"\"")
+	uris := make([]string, 0, len(prefixes))
+	for uri := range prefixes {
+		uris = append(uris, uri)
+	}
+	sort.Slice(uris, func(i, j int) bool {
+		return prefixes[uris[i]] < prefixes[uris[j]]
+	})
+	for _, uri := range uris {
+		if uri == NsRDF || uri == NsXML {
+			continue
+		}
+		buf.WriteString(fmt.Sprintf("\n    xmlns:%s=\"%s\"", prefixes[uri], escape(uri)))
+	}
+	buf.WriteString(">\n")
+
+	w := &writer{buf: &buf, prefixes: prefixes}
+	for _, prop := range p.Properties {
+		if err := w.property(prop, 3); err != nil {
+			return nil, err
+		}
+	}
+
+	buf.WriteString("  </rdf:Description>\n")
+	buf.WriteString(" </rdf:RDF>\n")
+	buf.WriteString("</x:xmpmeta>\n")
+	return buf.Bytes(), nil
+}
+
+// MarshalPacket serializes the packet with the xpacket wrapper and
+// padding bytes for in-place editing.
+func (p *Packet) MarshalPacket(padding int) ([]byte, error) {
+	body, err := p.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return wrap(body, padding), nil
+}
+
+func wrap(body []byte, padding int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(xpacketBegin)
+	buf.Write(body)
+	for padding > 0 {
+		n := 99
+		if padding < 100 {
+			n = padding - 1
+		}
+		buf.WriteString(strings.Repeat(" ", n))
+		buf.WriteByte('\n')
+		padding -= n + 1
+	}
+	buf.WriteString(xpacketEnd)
+	return buf.Bytes()
+}
+
+// MarshalJPEG serializes the packet for JPEG.
+// If the packet does not fit in an APP1 segment, top-level properties are
+// moved to the ExtendedXMP, and xmpNote:HasExtendedXMP of the StandardXMP
+// refers to the GUID (MD5 digest) of the ExtendedXMP.
+func (p *Packet) MarshalJPEG(padding int) (standard, extended []byte, guid string, err error) {
+	standard, err = p.MarshalPacket(padding)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if len(standard) <= MaxStandardXMPSize {
+		return standard, nil, "", nil
+	}
+
+	// split
+	std := p.clone()
+	std.Remove(NsXMPNote, "HasExtendedXMP")
+	ext := p.clone()
+	ext.Properties = nil
+
+	placeholder := &Property{Namespace: NsXMPNote, Name: "HasExtendedXMP", Kind: Simple, Value: strings.Repeat("0", 32)}
+	std.Set(placeholder)
+
+	for _, prop := range extendedCandidates(std) {
+		body, err := std.Marshal()
+		if err != nil {
+			return nil, nil, "", err
+		}
+		if len(wrap(body, 0)) <= MaxStandardXMPSize {
+			break
+		}
+		std.Remove(prop.Namespace, prop.Name)
+		ext.Properties = append(ext.Properties, prop)
+	}
+
+	extended, err = ext.Marshal()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	guid = fmt.Sprintf("%X", md5.Sum(extended))
+	placeholder.Value = guid
+
+	body, err := std.Marshal()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if len(wrap(body, 0)) > MaxStandardXMPSize {
+		return nil, nil, "", errors.New("StandardXMP is too large")
+	}
+	if max := MaxStandardXMPSize - len(wrap(body, 0)); padding > max {
+		padding = max
+	}
+	return wrap(body, padding), extended, guid, nil
+}
+
+// extendedCandidates returns the top-level properties in the order to move
+// to the ExtendedXMP: Camera Raw settings, photoshop:History, and the others
+// from the largest.
+func extendedCandidates(p *Packet) []*Property {
+	type candidate struct {
+		prop     *Property
+		priority int
+		size     int
+	}
+	var candidates []candidate
+	for _, prop := range p.Properties {
+		if prop.Namespace == NsXMPNote && prop.Name == "HasExtendedXMP" {
+			continue
+		}
+		c := candidate{prop: prop, priority: 2}
+		switch {
+		case prop.Namespace == NsCRS:
+			c.priority = 0
+		case prop.Namespace == NsPhotoshop && prop.Name == "History":
+			c.priority = 1
+		}
+		q := NewPacket()
+		q.Properties = []*Property{prop}
+		if b, err := q.Marshal(); err == nil {
+			c.size = len(b)
+		}
+		candidates = append(candidates, c)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].priority != candidates[j].priority {
+			return candidates[i].priority < candidates[j].priority
+		}
+		return candidates[i].size > candidates[j].size
+	})
+
+	props := make([]*Property, len(candidates))
+	for i, c := range candidates {
+		props[i] = c.prop
+	}
+	return props
+}
+
+func (p *Packet) clone() *Packet {
+	q := NewPacket()
+	for prefix, uri := range p.namespaces {
+		q.namespaces[prefix] = uri
+	}
+	for uri, prefix := range p.prefixes {
+		q.prefixes[uri] = prefix
+	}
+	q.Properties = append(q.Properties, p.Properties...)
+	return q
+}
+
+// assignPrefixes assigns a unique prefix to each namespace URI used.
+func (p *Packet) assignPrefixes() (map[string]string, error) {
+	prefixes := map[string]string{NsRDF: "rdf", NsXML: "xml"}
+	used := map[string]bool{"rdf": true, "xml": true, "x": true, "xmlns": true}
+
+	var assign func(prop *Property) error
+	assign = func(prop *Property) error {
+		if prop.Name != "" {
+			if prop.Namespace == "" {
+				return fmt.Errorf("no namespace: %s", prop.Name)
+			}
+			if _, ok := prefixes[prop.Namespace]; !ok {
+				prefix := p.Prefix(prop.Namespace)
+				if prefix == prop.Namespace || !isNCName(prefix) {
+					prefix = "ns"
+				}
+				for i := 1; used[prefix]; i++ {
+					prefix = fmt.Sprintf("%s%d", strings.TrimRight(prefix, "0123456789"), i)
+				}
+				prefixes[prop.Namespace] = prefix
+				used[prefix] = true
+			}
+		}
+		for _, children := range [][]*Property{prop.Qualifiers, prop.Fields, prop.Items} {
+			for _, child := range children {
+				if err := assign(child); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for _, prop := range p.Properties {
+		if err := assign(prop); err != nil {
+			return nil, err
+		}
+	}
+	return prefixes, nil
+}
+
+func isNCName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z'):
+		case i > 0 && (r == '-' || r == '.' || ('0' <= r && r <= '9')):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func escape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+type writer struct {
+	buf      *bytes.Buffer
+	prefixes map[string]string
+}
+
+func (w *writer) name(prop *Property) string {
+	if prop.Name == "" {
+		return "rdf:li"
+	}
+	return w.prefixes[prop.Namespace] + ":" + prop.Name
+}
+
+func (w *writer) indent(depth int) {
+	w.buf.WriteString(strings.Repeat(" ", depth))
+}
+
+// property writes a property element (or an array item).
+func (w *writer) property(prop *Property, depth int) error {
+	name := w.name(prop)
+
+	// xml:lang is written as the attribute, other qualifiers need rdf:value.
+	lang := ""
+	var qualifiers []*Property
+	for _, q := range prop.Qualifiers {
+		if q.Namespace == NsXML && q.Name == "lang" {
+			lang = fmt.Sprintf(" xml:lang=\"%s\"", escape(q.Value))
+		} else {
+			qualifiers = append(qualifiers, q)
+		}
+	}
+
+	w.indent(depth)
+	if len(qualifiers) > 0 {
+		w.buf.WriteString(fmt.Sprintf("<%s%s rdf:parseType=\"Resource\">\n", name, lang))
+		value := *prop
+		value.Namespace, value.Name = NsRDF, "value"
+		value.Qualifiers = nil
+		if err := w.property(&value, depth+1); err != nil {
+			return err
+		}
+		for _, q := range qualifiers {
+			if err := w.property(q, depth+1); err != nil {
+				return err
+			}
+		}
+		w.indent(depth)
+		w.buf.WriteString(fmt.Sprintf("</%s>\n", name))
+		return nil
+	}
+
+	switch prop.Kind {
+	case Simple:
+		if prop.URI {
+			w.buf.WriteString(fmt.Sprintf("<%s%s rdf:resource=\"%s\"/>\n", name, lang, escape(prop.Value)))
+		} else {
+			w.buf.WriteString(fmt.Sprintf("<%s%s>%s</%s>\n", name, lang, escape(prop.Value), name))
+		}
+	case Struct:
+		w.buf.WriteString(fmt.Sprintf("<%s%s rdf:parseType=\"Resource\">\n", name, lang))
+		for _, f := range prop.Fields {
+			if err := w.property(f, depth+1); err != nil {
+				return err
+			}
+		}
+		w.indent(depth)
+		w.buf.WriteString(fmt.Sprintf("</%s>\n", name))
+	case Bag, Seq, Alt:
+		w.buf.WriteString(fmt.Sprintf("<%s%s>\n", name, lang))
+		w.indent(depth + 1)
+		w.buf.WriteString(fmt.Sprintf("<rdf:%s>\n", prop.Kind))
+		for _, item := range prop.Items {
+			li := *item
+			li.Namespace, li.Name = "", ""
+			if err := w.property(&li, depth+2); err != nil {
+				return err
+			}
+		}
+		w.indent(depth + 1)
+		w.buf.WriteString(fmt.Sprintf("</rdf:%s>\n", prop.Kind))
+		w.indent(depth)
+		w.buf.WriteString(fmt.Sprintf("</%s>\n", name))
+	default:
+		return fmt.Errorf("unknown kind: %s", prop.Kind)
+	}
+	return nil
+}
@@ -0,0 +1,367 @@
+package xmp
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kind is the kind of XMP property value.
+type Kind int
+
+// Kind of XMP property value
+const (
+	Simple Kind = iota
+	Struct
+	Bag
+	Seq
+	Alt
+)
+
+var kindName = map[Kind]string{
+	Simple: "Simple",
+	Struct: "Struct",
+	Bag:    "Bag",
+	Seq:    "Seq",
+	Alt:    "Alt",
+}
+
+// String makes Kind satisfy the Stringer interface.
+func (k Kind) String() string {
+	name, ok := kindName[k]
+	if !ok {
+		name = strconv.Itoa(int(k))
+	}
+	return name
+}
+
+// Property is a node of the XMP data model.
+// Array items have no name.
+type Property struct {
+	Namespace string
+	Name      string
+	Kind      Kind
+
+	// Simple
+	Value string
+	URI   bool // the value is rdf:resource
+
+	// Struct
+	Fields []*Property
+
+	// Bag, Seq, Alt
+	Items []*Property
+
+	Qualifiers []*Property
+}
+
+// IsArray returns that the property is an array or not.
+func (p *Property) IsArray() bool {
+	return p.Kind == Bag || p.Kind == Seq || p.Kind == Alt
+}
+
+// Field returns the field of the struct.
+func (p *Property) Field(ns, name string) *Property {
+	return find(p.Fields, ns, name)
+}
+
+// Qualifier returns the qualifier of the property.
+func (p *Property) Qualifier(ns, name string) *Property {
+	return find(p.Qualifiers, ns, name)
+}
+
+// Lang returns the xml:lang qualifier.
+func (p *Property) Lang() string {
+	if q := p.Qualifier(NsXML, "lang"); q != nil {
+		return q.Value
+	}
+	return ""
+}
+
+// IsLangAlt returns that the property is a language alternative or not.
+func (p *Property) IsLangAlt() bool {
+	if p.Kind != Alt || len(p.Items) == 0 {
+		return false
+	}
+	for _, item := range p.Items {
+		if item.Lang() == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// LangItem returns the item of the language alternative for lang,
+// falling back to x-default and then to the first item.
+func (p *Property) LangItem(lang string) *Property {
+	if p.Kind != Alt || len(p.Items) == 0 {
+		return nil
+	}
+	for _, l := range []string{lang, "x-default"} {
+		for _, item := range p.Items {
+			if strings.EqualFold(item.Lang(), l) {
+				return item
+			}
+		}
+	}
+	return p.Items[0]
+}
+
+func find(props []*Property, ns, name string) *Property {
+	for _, p := range props {
+		if p.Namespace == ns && p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Packet is the XMP data model of the packet(s).
+type Packet struct {
+	Properties []*Property
+
+	// prefix -> namespace URI / namespace URI -> prefix
+	namespaces map[string]string
+	prefixes   map[string]string
+}
+
+// NewPacket creates a new empty Packet.
+func NewPacket() *Packet {
+	return &Packet{
+		namespaces: map[string]string{},
+		prefixes:   map[string]string{},
+	}
+}
+
+// RegisterNamespace binds prefix to the namespace URI.
+// The first binding of a prefix or a URI wins.
+func (p *Packet) RegisterNamespace(prefix, uri string) {
+	if _, ok := p.namespaces[prefix]; !ok {
+		p.namespaces[prefix] = uri
+	}
+	if _, ok := p.prefixes[uri]; !ok {
+		p.prefixes[uri] = prefix
+	}
+}
+
+// Namespace resolves prefix to the namespace URI.
+func (p *Packet) Namespace(prefix string) (string, bool) {
+	if uri, ok := p.namespaces[prefix]; ok {
+		return uri, true
+	}
+	uri, ok := wellKnownNamespace[prefix]
+	return uri, ok
+}
+
+// Prefix returns the prefix of the namespace URI.
+func (p *Packet) Prefix(uri string) string {
+	if prefix, ok := p.prefixes[uri]; ok {
+		return prefix
+	}
+	if prefix, ok := wellKnownPrefix[uri]; ok {
+		return prefix
+	}
+	return uri
+}
+
+// Namespaces returns the namespace URIs used in the packet, sorted by prefix.
+func (p *Packet) Namespaces() []string {
+	uris := make([]string, 0, len(p.prefixes))
+	for uri := range p.prefixes {
+		uris = append(uris, uri)
+	}
+	sort.Slice(uris, func(i, j int) bool {
+		return p.Prefix(uris[i]) < p.Prefix(uris[j])
+	})
+	return uris
+}
+
+// Property returns the top-level property.
+func (p *Packet) Property(ns, name string) *Property {
+	return find(p.Properties, ns, name)
+}
+
+// Merge adds the properties of q which p does not have.
+func (p *Packet) Merge(q *Packet) {
+	for prefix, uri := range q.namespaces {
+		p.RegisterNamespace(prefix, uri)
+	}
+	for _, prop := range q.Properties {
+		if p.Property(prop.Namespace, prop.Name) == nil {
+			p.Properties = append(p.Properties, prop)
+		}
+	}
+}
+
+// Walk calls fn for each property, array item and qualifier in the
+// document order with its path.
+func (p *Packet) Walk(fn func(path string, prop *Property)) {
+	for _, prop := range p.Properties {
+		p.walk(p.qualifiedName(prop), prop, fn)
+	}
+}
+
+func (p *Packet) walk(path string, prop *Property, fn func(path string, prop *Property)) {
+	fn(path, prop)
+	for _, q := range prop.Qualifiers {
+		p.walk(path+"/?"+p.qualifiedName(q), q, fn)
+	}
+	for _, f := range prop.Fields {
+		p.walk(path+"/"+p.qualifiedName(f), f, fn)
+	}
+	for i, item := range prop.Items {
+		p.walk(fmt.Sprintf("%s[%d]", path, i+1), item, fn)
+	}
+}
+
+func (p *Packet) qualifiedName(prop *Property) string {
+	return p.Prefix(prop.Namespace) + ":" + prop.Name
+}
+
+// String makes Packet satisfy the Stringer interface.
+func (p *Packet) String() string {
+	var buf bytes.Buffer
+	p.Walk(func(path string, prop *Property) {
+		if prop.Kind == Simple {
+			buf.WriteString(fmt.Sprintf("  %s = %s\n", path, prop.Value))
+		}
+	})
+	return buf.String()
+}
+
+// Get returns the value of the simple property at path.
+func (p *Packet) Get(path string) (string, bool) {
+	prop, err := p.Lookup(path)
+	if err != nil || prop.Kind != Simple {
+		return "", false
+	}
+	return prop.Value, true
+}
+
+// Lookup returns the property at path.
+//
+// The path is a sequence of qualified names separated by '/', e.g.
+//
+//	GDepth:Format
+//	xmpMM:History[1]/stEvt:action
+//	dc:title[?xml:lang="x-default"]
+//	dc:subject[last()]
+//	dc:title[1]/?xml:lang
+func (p *Packet) Lookup(path string) (*Property, error) {
+	steps := strings.Split(path, "/")
+
+	var cur *Property
+	for i, step := range steps {
+		qualifier := strings.HasPrefix(step, "?")
+		step = strings.TrimPrefix(step, "?")
+
+		name := step
+		var selectors []string
+		if j := strings.IndexByte(step, '['); j >= 0 {
+			name = step[:j]
+			var err error
+			selectors, err = splitSelectors(step[j:])
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		ns, local, err := p.resolve(name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case i == 0 && !qualifier:
+			cur = p.Property(ns, local)
+		case i == 0:
+			return nil, fmt.Errorf("qualifier at the top of path: %s", path)
+		case qualifier:
+			cur = cur.Qualifier(ns, local)
+		default:
+			cur = cur.Field(ns, local)
+		}
+		if cur == nil {
+			return nil, fmt.Errorf("not found: %s", name)
+		}
+
+		for _, sel := range selectors {
+			cur, err = p.selectItem(cur, sel)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return cur, nil
+}
+
+func splitSelectors(s string) ([]string, error) {
+	var selectors []string
+	for len(s) > 0 {
+		if s[0] != '[' {
+			return nil, fmt.Errorf("invalid selector: %s", s)
+		}
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid selector: %s", s)
+		}
+		selectors = append(selectors, s[1:end])
+		s = s[end+1:]
+	}
+	return selectors, nil
+}
+
+func (p *Packet) selectItem(prop *Property, sel string) (*Property, error) {
+	if !prop.IsArray() {
+		return nil, fmt.Errorf("not an array: %s", prop.Name)
+	}
+
+	switch {
+	case sel == "last()":
+		if len(prop.Items) == 0 {
+			return nil, fmt.Errorf("empty array: %s", prop.Name)
+		}
+		return prop.Items[len(prop.Items)-1], nil
+	case strings.HasPrefix(sel, "?"):
+		// [?ns:qual="value"]
+		eq := strings.IndexByte(sel, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("invalid selector: %s", sel)
+		}
+		ns, local, err := p.resolve(sel[1:eq])
+		if err != nil {
+			return nil, err
+		}
+		value := strings.Trim(sel[eq+1:], `"'`)
+		for _, item := range prop.Items {
+			if q := item.Qualifier(ns, local); q != nil && q.Value == value {
+				return item, nil
+			}
+		}
+		return nil, fmt.Errorf("not found: [%s]", sel)
+	default:
+		n, err := strconv.Atoi(sel)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector: %s", sel)
+		}
+		if n < 1 || n > len(prop.Items) {
+			return nil, fmt.Errorf("index out of range: [%d]", n)
+		}
+		return prop.Items[n-1], nil
+	}
+}
+
+func (p *Packet) resolve(name string) (string, string, error) {
+	colon := strings.IndexByte(name, ':')
+	if colon < 0 {
+		return "", "", fmt.Errorf("no prefix: %s", name)
+	}
+	ns, ok := p.Namespace(name[:colon])
+	if !ok {
+		return "", "", fmt.Errorf("unknown prefix: %s", name[:colon])
+	}
+	return ns, name[colon+1:], nil
+}